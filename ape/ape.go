@@ -0,0 +1,178 @@
+// Package ape reads APEv1 and APEv2 tags.
+package ape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// HeaderSize is the size of the header and of the footer of a tag.
+const HeaderSize = 32
+
+// Flags of the header and the footer.
+const (
+	FlagHasHeader = 1 << 31
+	FlagNoFooter  = 1 << 30
+	FlagIsHeader  = 1 << 29
+)
+
+// Types of item values, which are in the flags of an item.
+const (
+	ItemText     = 0
+	ItemBinary   = 1
+	ItemLocator  = 2
+	itemTypeMask = 0x6
+)
+
+// Tag is an APE tag.
+type Tag struct {
+	// Version is 1000 for APEv1 and 2000 for APEv2.
+	Version int
+
+	// Items is the items of the tag in the order they appear.
+	Items []*Item
+}
+
+// Item is an item of a tag.
+type Item struct {
+	// Key is the key like "Artist" or "REPLAYGAIN_TRACK_GAIN".
+	Key string
+
+	// Flags is the flags of the item.
+	Flags uint32
+
+	// Value is the value, which is UTF-8 text unless the type is ItemBinary.
+	Value []byte
+}
+
+// IsHeader returns whether b starts with the header of a tag.
+func IsHeader(b []byte) bool {
+	return hasPreamble(b) && binary.LittleEndian.Uint32(b[20:24])&FlagIsHeader != 0
+}
+
+// IsFooter returns whether b starts with the footer of a tag.
+func IsFooter(b []byte) bool {
+	return hasPreamble(b) && binary.LittleEndian.Uint32(b[20:24])&FlagIsHeader == 0
+}
+
+// hasPreamble returns whether b starts with a header or a footer.
+func hasPreamble(b []byte) bool {
+	return len(b) >= HeaderSize && string(b[:8]) == "APETAGEX"
+}
+
+// TagSize returns the size of the tag with the given header or footer,
+// including the header when there is one.
+func TagSize(b []byte) (int, error) {
+	if !hasPreamble(b) {
+		return 0, errors.New("ape: invalid header")
+	}
+
+	// the size includes the footer but not the header
+	size := int(binary.LittleEndian.Uint32(b[12:16]))
+	if size < HeaderSize {
+		return 0, errors.New("ape: invalid size")
+	}
+
+	if flags := binary.LittleEndian.Uint32(b[20:24]); flags&FlagHasHeader != 0 {
+		size += HeaderSize
+	}
+
+	return size, nil
+}
+
+// Parse parses a tag in b, which has either the header at its start,
+// the footer at its end, or both.
+func Parse(b []byte) (*Tag, error) {
+	var h []byte
+	switch {
+	case IsHeader(b):
+		h, b = b[:HeaderSize], b[HeaderSize:]
+		// the footer may follow the items
+		if len(b) >= HeaderSize && IsFooter(b[len(b)-HeaderSize:]) {
+			b = b[:len(b)-HeaderSize]
+		}
+	case len(b) >= HeaderSize && IsFooter(b[len(b)-HeaderSize:]):
+		h, b = b[len(b)-HeaderSize:], b[:len(b)-HeaderSize]
+		// the header may precede the items
+		if IsHeader(b) {
+			b = b[HeaderSize:]
+		}
+	default:
+		return nil, errors.New("ape: no header or footer")
+	}
+
+	t := &Tag{
+		Version: int(binary.LittleEndian.Uint32(h[8:12])),
+	}
+
+	n := int(binary.LittleEndian.Uint32(h[16:20]))
+	for i := 0; i < n; i++ {
+		if len(b) < 8 {
+			return nil, errors.New("ape: item is truncated")
+		}
+
+		size := int(binary.LittleEndian.Uint32(b[:4]))
+		flags := binary.LittleEndian.Uint32(b[4:8])
+		b = b[8:]
+
+		end := bytes.IndexByte(b, 0)
+		if end < 0 {
+			return nil, errors.New("ape: item key is not terminated")
+		}
+
+		key := string(b[:end])
+		b = b[end+1:]
+		if size < 0 || size > len(b) {
+			return nil, errors.New("ape: item value is truncated")
+		}
+
+		t.Items = append(t.Items, &Item{
+			Key:   key,
+			Flags: flags,
+			Value: b[:size:size],
+		})
+		b = b[size:]
+	}
+
+	return t, nil
+}
+
+// Item returns the item with the given key, which is not case-sensitive,
+// or nil when there is none.
+func (t *Tag) Item(key string) *Item {
+	for _, i := range t.Items {
+		if strings.EqualFold(i.Key, key) {
+			return i
+		}
+	}
+
+	return nil
+}
+
+// Text returns the first value of the text item with the given key,
+// or an empty string when there is none.
+func (t *Tag) Text(key string) string {
+	i := t.Item(key)
+	if i == nil || i.Type() != ItemText {
+		return ""
+	}
+
+	if values := i.Text(); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// Type returns the type of the value, ItemText, ItemBinary or ItemLocator.
+func (i *Item) Type() int {
+	return int(i.Flags&itemTypeMask) >> 1
+}
+
+// Text returns the values of a text item, which may have several values
+// separated by zero bytes.
+func (i *Item) Text() []string {
+	return strings.Split(string(i.Value), "\x00")
+}
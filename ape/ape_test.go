@@ -0,0 +1,77 @@
+package ape_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	. "github.com/pchchv/mp3/ape"
+)
+
+// tag returns an APEv2 tag with the items as key and value pairs.
+func tag(header bool, items ...string) []byte {
+	var body []byte
+	for i := 0; i < len(items); i += 2 {
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(items[i+1])))
+		body = binary.LittleEndian.AppendUint32(body, 0)
+		body = append(body, items[i]...)
+		body = append(body, 0)
+		body = append(body, items[i+1]...)
+	}
+
+	var flags uint32
+	if header {
+		flags |= FlagHasHeader
+	}
+
+	h := func(flags uint32) []byte {
+		b := []byte("APETAGEX")
+		b = binary.LittleEndian.AppendUint32(b, 2000)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(body)+HeaderSize))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(items)/2))
+		b = binary.LittleEndian.AppendUint32(b, flags)
+		return append(b, make([]byte, 8)...)
+	}
+
+	var b []byte
+	if header {
+		b = h(flags | FlagIsHeader)
+	}
+	b = append(b, body...)
+	return append(b, h(flags)...)
+}
+
+func TestParse(t *testing.T) {
+	for _, header := range []bool{false, true} {
+		b := tag(header, "Artist", "A\x00B", "MP3GAIN_MINMAX", "120,210")
+		size, err := TagSize(b[len(b)-HeaderSize:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size != len(b) {
+			t.Errorf("TagSize() with header %t: got %d, want %d", header, size, len(b))
+		}
+
+		if header != IsHeader(b) {
+			t.Errorf("IsHeader() with header %t: got %t", header, !header)
+		}
+
+		tg, err := Parse(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tg.Version != 2000 || len(tg.Items) != 2 {
+			t.Fatalf("Parse() with header %t: got %+v", header, tg)
+		}
+
+		if got, want := tg.Item("artist").Text(), []string{"A", "B"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Item(%q).Text(): got %q, want %q", "artist", got, want)
+		}
+
+		if got := tg.Text("MP3GAIN_MINMAX"); got != "120,210" {
+			t.Errorf("Text(%q): got %q", "MP3GAIN_MINMAX", got)
+		}
+	}
+}
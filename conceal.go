@@ -0,0 +1,73 @@
+package mp3
+
+import "github.com/pchchv/mp3/internal/frame"
+
+// concealGain is the gain of each frame repeated by ConcealRepeat,
+// which fades out the frames repeated in a row.
+const concealGain = 0.5
+
+// Concealment is how Decoder conceals a frame that can't be decoded.
+type Concealment int
+
+const (
+	// ConcealNone makes Read return the error of the frame,
+	// which is the default. Reading again continues with the next frame.
+	ConcealNone Concealment = iota
+
+	// ConcealSilence replaces the frame with silence.
+	ConcealSilence
+
+	// ConcealRepeat repeats the previous frame, which fades out
+	// when frames are repeated in a row.
+	ConcealRepeat
+
+	// ConcealInterpolate interpolates the previous and the next frames,
+	// or repeats the previous frame when the next one can't be decoded.
+	ConcealInterpolate
+)
+
+// conceal conceals the frame at the byte offset pos
+// that can't be decoded with the error err.
+func (d *Decoder) conceal(pos int64, err error) error {
+	c := d.concealment
+	if c == ConcealNone {
+		if _, ok := err.(*CRCError); !ok {
+			return err
+		}
+		// a frame whose CRC doesn't match is replaced with silence by default
+		c = ConcealSilence
+	}
+
+	if d.onConceal != nil {
+		d.onConceal(pos, err)
+	}
+
+	switch c {
+	case ConcealSilence:
+		d.appendFrame(d.frame.Silence())
+	case ConcealRepeat:
+		d.appendFrame(d.frame.Repeat(concealGain))
+	case ConcealInterpolate:
+		// the next frame is read ahead, and is decoded after this one
+		next, nextPos, err := frame.Read(d.source, d.source.pos, d.frame)
+		if err != nil {
+			// the error is returned in place of reading the next frame,
+			// whose data is read already
+			d.appendFrame(d.frame.Repeat(concealGain))
+			d.nextErr = err
+			return nil
+		}
+
+		if next.Err() == nil && (next.CRCValid() || d.crcPolicy == CRCIgnore) {
+			d.appendFrame(d.frame.Interpolate(next))
+		} else {
+			d.appendFrame(d.frame.Repeat(concealGain))
+		}
+
+		next.Continue(d.frame)
+		d.next = next
+		d.nextPos = nextPos
+	}
+
+	return nil
+}
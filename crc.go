@@ -0,0 +1,29 @@
+package mp3
+
+import "fmt"
+
+// CRCPolicy is what Decoder does with a frame whose CRC doesn't match.
+type CRCPolicy int
+
+const (
+	// CRCIgnore decodes the frame as it is, which is the default.
+	CRCIgnore CRCPolicy = iota
+
+	// CRCConceal conceals the frame as WithConcealment tells,
+	// or replaces it with silence by default.
+	CRCConceal
+
+	// CRCFail makes Read return a *CRCError for the frame.
+	// Reading again continues with the next frame.
+	CRCFail
+)
+
+// CRCError is the error for a frame whose CRC doesn't match.
+type CRCError struct {
+	// Offset is the byte offset of the frame in the source.
+	Offset int64
+}
+
+func (e *CRCError) Error() string {
+	return fmt.Sprintf("mp3: CRC mismatch in the frame at %d", e.Offset)
+}
@@ -1,46 +1,115 @@
 package mp3
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"sort"
+	"time"
 
+	"github.com/pchchv/mp3/ape"
+	"github.com/pchchv/mp3/id3"
 	"github.com/pchchv/mp3/internal/consts"
 	"github.com/pchchv/mp3/internal/frame"
 	"github.com/pchchv/mp3/internal/frameheader"
 )
 
-const invalidLength = -1
+const (
+	invalidLength = -1
+
+	// reservoirBytes is the number of bytes before a frame that are read
+	// to fill the bit reservoir when the frame starts are not known,
+	// which is more than the 511 bytes of main data it can have
+	// with the headers and the side info of the frames in them
+	reservoirBytes = 1024
+)
 
 // Decoder is a MP3-decoded stream.
 // Decoder decodes its underlying source on the fly.
 type Decoder struct {
-	source        *source
-	sampleRate    int
-	length        int64
-	frameStarts   []int64
-	buf           []byte
-	frame         *frame.Frame
-	pos           int64
-	bytesPerFrame int64
+	source         *source
+	sampleRate     int
+	length         int64
+	frameStarts    []int64
+	frame          *frame.Frame
+	pos            int64
+	bytesPerFrame  int64
+	firstFramePos  int64
+	firstFrameSize int
+	xing           *XingHeader
+	vbri           *VBRIHeader
+	gapless        bool
+	nativeChannels bool
+	channels       int
+	format         Format
+	dither         Dither
+	crcPolicy      CRCPolicy
+	concealment    Concealment
+	onConceal      func(int64, error)
+	// start and end are the positions in the decoded stream
+	// of the first and after the last sample, that are
+	// other than 0 and length when gapless trimming is done
+	start int64
+	end   int64
+	// frameSamples is the index of the first sample of each frame
+	// in frameStarts, followed by the number of all the samples,
+	// as frames of different versions have different numbers of samples
+	frameSamples []int64
+	// pcm is the samples of each channel that are decoded and not read yet
+	pcm [][]float32
+	// buf is the rest of a sample that is partly read
+	buf []byte
+	// rand and ditherErr are the state of the dither
+	rand      uint32
+	ditherErr []float64
+	// next is the frame at nextPos that is read ahead
+	// to conceal the current frame, or nil
+	next    *frame.Frame
+	nextPos int64
+	// nextErr is the error of reading the frame ahead,
+	// which is returned in place of reading the next frame
+	nextErr error
+	// seekHeader is the header of the frame that the source is at
+	// after seeking to a frame start in frameStarts, or 0
+	seekHeader frameheader.FrameHeader
+	// flushed is whether the samples after the last frame
+	// are flushed out of the synthesis
+	flushed bool
 }
 
 // NewDecoder decodes the given io.Reader and returns a decoded stream.
-// The stream is always formatted as 16bit (little endian)
-// 2 channels even if the source is single channel MP3.
-// Thus, a sample always consists of 4 bytes.
-func NewDecoder(r io.Reader) (*Decoder, error) {
+// The stream is formatted as 16bit (little endian) 2 channels
+// even if the source is single channel MP3, unless WithNativeChannels(true)
+// or WithFormat is given. Thus, a sample consists of 4 bytes by default.
+//
+// The encoder delay and padding are trimmed when the stream has a LAME
+// header, unless WithGapless(false) is given.
+func NewDecoder(r io.Reader, options ...Option) (*Decoder, error) {
 	s := &source{
 		reader: r,
 	}
 	d := &Decoder{
-		source: s,
-		length: invalidLength,
+		source:  s,
+		length:  invalidLength,
+		gapless: true,
+	}
+	for _, o := range options {
+		o(d)
+	}
+
+	if err := s.readTrailingTags(); err != nil {
+		return nil, err
 	}
 
 	if err := s.skipTags(); err != nil {
 		return nil, err
 	}
 
+	if err := d.readVBRHeader(); err != nil {
+		return nil, err
+	}
+
 	if err := d.readFrame(); err != nil {
 		return nil, err
 	}
@@ -51,18 +120,105 @@ func NewDecoder(r io.Reader) (*Decoder, error) {
 	}
 	d.sampleRate = freq
 
-	if err = d.ensureFrameStartsAndLength(); err != nil {
+	if frames := d.vbrFrames(); frames > 0 {
+		d.length = frames * d.bytesPerFrame
+	} else if err = d.ensureFrameStartsAndLength(); err != nil {
 		return nil, err
 	}
 
+	d.end = d.length
+	if d.gapless && d.xing != nil && d.xing.LAME != nil {
+		d.trim(d.xing.LAME)
+	}
+
 	return d, nil
 }
 
+// trim sets the range of the decoded stream without
+// the encoder delay and padding that l tells.
+func (d *Decoder) trim(l *LAMEHeader) {
+	d.start = int64(l.EncoderDelay+decoderDelay) * d.bytesPerSample()
+	if d.length == invalidLength {
+		return
+	}
+
+	// the decoder delay shifts the padding as well, and when the padding
+	// is shorter than the delay, the last samples are after the last frame,
+	// which are flushed out of the synthesis
+	d.end = d.length - int64(l.Padding-decoderDelay)*d.bytesPerSample()
+	if d.end < d.start {
+		d.end = d.start
+	}
+}
+
 // Length returns the total size in bytes.
 // Length returns -1 when the total size is not available
-// e.g. when the given source is not io.Seeker.
+// e.g. when the given source is not io.Seeker and has no Xing header.
 func (d *Decoder) Length() int64 {
-	return d.length
+	if d.length == invalidLength {
+		return invalidLength
+	}
+	return d.end - d.start
+}
+
+// Xing returns the Xing header of the stream,
+// or nil when the first frame has no Xing header.
+func (d *Decoder) Xing() *XingHeader {
+	return d.xing
+}
+
+// ID3v2 returns the ID3v2 tag at the start of the stream,
+// or nil when there is none or it can't be read.
+// When the source is io.Seeker, the tag is read at the first call
+// so that large pictures in it are not read when they are not needed.
+func (d *Decoder) ID3v2() *id3.Tag {
+	return d.source.loadID3v2()
+}
+
+// ID3v1 returns the ID3v1 tag at the end of the stream,
+// or nil when there is none or the source is not io.Seeker.
+func (d *Decoder) ID3v1() *id3.V1Tag {
+	return d.source.id3v1
+}
+
+// APE returns the APE tag of the stream, which is usually at the end,
+// or nil when there is none or it can't be read.
+func (d *Decoder) APE() *ape.Tag {
+	return d.source.ape
+}
+
+// VBRI returns the VBRI header of the stream,
+// or nil when the first frame has no VBRI header.
+func (d *Decoder) VBRI() *VBRIHeader {
+	return d.vbri
+}
+
+// hasVBRHeader returns whether the first frame has a Xing or VBRI header.
+func (d *Decoder) hasVBRHeader() bool {
+	return d.xing != nil || d.vbri != nil
+}
+
+// vbrFrames returns the number of frames that the VBR header tells,
+// or 0 when it is not available.
+func (d *Decoder) vbrFrames() int64 {
+	switch {
+	case d.xing != nil:
+		return d.xing.Frames
+	case d.vbri != nil:
+		return d.vbri.Frames
+	}
+	return 0
+}
+
+// hasTOC returns whether the VBR header has a table of contents for seeking.
+func (d *Decoder) hasTOC() bool {
+	return d.xing != nil && d.xing.TOC != nil || d.vbri != nil && d.vbri.TOC != nil
+}
+
+// Channels returns the number of channels of the decoded stream,
+// which is 2 unless WithNativeChannels(true) is given.
+func (d *Decoder) Channels() int {
+	return d.channels
 }
 
 // SampleRate returns the sample rate like 44100.
@@ -71,13 +227,23 @@ func (d *Decoder) SampleRate() int {
 	return d.sampleRate
 }
 
-// Seek returns an error when the underlying source is not io.Seeker.
+// Seek returns an error when the underlying source is not io.Seeker
+// or the new position is negative.
 // Note that seek uses a byte offset but samples are aligned to 4 bytes
-// (2 channels, 2 bytes each).
+// (2 channels, 2 bytes each) by default, or to the size of a sample
+// with WithNativeChannels(true) or WithFormat.
+// The position can be approximate when the stream has the table of contents
+// of a VBR header, and SeekSample seeks to a sample exactly.
 func (d *Decoder) Seek(offset int64, whence int) (int64, error) {
+	// the position before the trimmed start is not skipped yet
+	cur := d.pos - d.start
+	if cur < 0 {
+		cur = 0
+	}
+
 	if offset == 0 && whence == io.SeekCurrent {
 		// handle the special case of asking for the current position specially
-		return d.pos, nil
+		return cur, nil
 	}
 
 	npos := int64(0)
@@ -85,82 +251,355 @@ func (d *Decoder) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekStart:
 		npos = offset
 	case io.SeekCurrent:
-		npos = d.pos + offset
+		npos = cur + offset
 	case io.SeekEnd:
 		npos = d.Length() + offset
 	default:
 		return 0, errors.New("mp3: invalid whence")
 	}
 
-	d.pos = npos
+	if npos < 0 {
+		return 0, errors.New("mp3: negative position")
+	}
+
+	if err := d.seek(d.start + npos); err != nil {
+		return 0, err
+	}
+
+	return npos, nil
+}
+
+// SeekChapter seeks to the start of the chapter with the element ID id
+// in the ID3v2 tag, and returns the new position like Seek.
+// The position is of the first frame of the chapter when the chapter has
+// its byte offset and the source is io.Seeker, or of its start time otherwise.
+func (d *Decoder) SeekChapter(id string) (int64, error) {
+	tag := d.ID3v2()
+	if tag == nil {
+		return 0, errors.New("mp3: no ID3v2 tag")
+	}
+
+	c := tag.Chapter(id)
+	if c == nil {
+		return 0, fmt.Errorf("mp3: chapter %q is not found", id)
+	}
+
+	// the time of a chapter is in milliseconds
+	pos := c.Start.Milliseconds() * int64(d.sampleRate) / 1000 * d.bytesPerSample()
+	if c.StartOffset >= 0 {
+		if err := d.ensureFrameStartsAndLength(); err != nil {
+			return 0, err
+		}
+
+		// the frame that starts at the offset
+		f := sort.Search(len(d.frameStarts), func(i int) bool {
+			return d.frameStarts[i] >= c.StartOffset
+		})
+		if f < len(d.frameStarts) && d.frameStarts[f] == c.StartOffset {
+			pos = d.frameSamples[f]*d.bytesPerSample() - d.start
+			if pos < 0 {
+				pos = 0
+			}
+		}
+	}
+
+	return d.Seek(pos, io.SeekStart)
+}
+
+// SeekSample seeks to the sample n of each channel in the decoded stream,
+// which is counted like Length after the encoder delay is skipped.
+// Unlike Seek, which can use the table of contents of the VBR header,
+// SeekSample scans the frames of the stream on the first call to know
+// the first sample of each frame, so that the position is exact even
+// when the frames have different numbers of samples.
+func (d *Decoder) SeekSample(n int64) error {
+	if n < 0 {
+		return errors.New("mp3: negative sample")
+	}
+
+	if err := d.ensureFrameStartsAndLength(); err != nil {
+		return err
+	}
+
+	if d.frameStarts == nil {
+		return errors.New("mp3: source must be io.Seeker")
+	}
+
+	return d.seek(d.start + n*d.bytesPerSample())
+}
+
+// SeekTime seeks to the sample at the time t in the decoded stream
+// with the sample rate of SampleRate like SeekSample.
+// The time is rounded down to a sample.
+func (d *Decoder) SeekTime(t time.Duration) error {
+	if t < 0 {
+		return errors.New("mp3: negative time")
+	}
+
+	// split the time not to overflow
+	rate := int64(d.sampleRate)
+	n := int64(t/time.Second)*rate + int64(t%time.Second)*rate/int64(time.Second)
+	return d.SeekSample(n)
+}
+
+// seek seeks to the position pos in the decoded stream before trimming.
+func (d *Decoder) seek(pos int64) error {
+	d.pos = pos
 	d.buf = nil
+	d.pcm = nil
 	d.frame = nil
-	f := d.pos / d.bytesPerFrame
-	// if the frame is not first,
-	// read the previous ahead of reading that because the
-	// previous frame can affect the targeted frame
-	if f > 0 {
-		f--
-		if _, err := d.source.Seek(d.frameStarts[f], 0); err != nil {
-			return 0, err
+	d.next = nil
+	d.nextErr = nil
+	d.seekHeader = 0
+	d.flushed = false
+	if d.frameStarts == nil {
+		if d.hasTOC() {
+			return d.seekTOC()
 		}
 
-		if err := d.readFrame(); err != nil {
-			return 0, err
+		if err := d.ensureFrameStartsAndLength(); err != nil {
+			return err
 		}
+	}
+
+	if d.frameStarts == nil {
+		return errors.New("mp3: source must be io.Seeker")
+	}
+
+	// the frame that has the sample at the position, which is the one
+	// after the last frame for the samples flushed out of the synthesis,
+	// and nothing is read when it is out of the stream
+	n := d.pos / d.bytesPerSample()
+	i := sort.Search(len(d.frameSamples), func(i int) bool {
+		return d.frameSamples[i] > n
+	})
+	if i == 0 || i == len(d.frameSamples) && d.pos >= d.end {
+		return nil
+	}
+
+	f := int64(i - 1)
+	// the frames before the targeted one are decoded ahead of it
+	// because they affect the targeted frame through the synthesis,
+	// which reaches back two frames of a single granule,
+	// and the frames before them whose main data they need
+	// are read without decoding to fill the bit reservoir
+	first := f - 2
+	if first < 0 {
+		first = 0
+	}
 
+	start, err := d.reservoirStart(first, f)
+	if err != nil {
+		return err
+	}
+
+	// the frame is known to start there,
+	// and is read without confirming it with the frames after it
+	b, err := d.source.readAt(d.frameStarts[start], 4)
+	if err != nil {
+		return err
+	}
+	d.seekHeader = frameheader.FrameHeader(binary.BigEndian.Uint32(b))
+
+	if _, err := d.source.Seek(d.frameStarts[start], 0); err != nil {
+		return err
+	}
+
+	for i := start; i < first; i++ {
+		if _, err := d.nextFrame(); err != nil {
+			return err
+		}
+	}
+
+	for i := first; i <= f; i++ {
 		if err := d.readFrame(); err != nil {
-			return 0, err
+			return err
 		}
-		d.buf = d.buf[d.bytesPerFrame+(d.pos%d.bytesPerFrame):]
-	} else {
-		if _, err := d.source.Seek(d.frameStarts[f], 0); err != nil {
+	}
+	d.skip(d.pos - d.frameSamples[first]*d.bytesPerSample())
+	return nil
+}
+
+// reservoirStart returns the index of the first frame whose main data
+// the frames from first to last need from the bit reservoir,
+// which is first if they need none.
+func (d *Decoder) reservoirStart(first, last int64) (int64, error) {
+	start := first
+	for i := first; i <= last && i < int64(len(d.frameStarts)); i++ {
+		begin, _, err := d.reservoir(i)
+		if err != nil {
 			return 0, err
 		}
 
-		if err := d.readFrame(); err != nil {
-			return 0, err
+		j := i
+		for begin > 0 && j > 0 {
+			j--
+			_, size, err := d.reservoir(j)
+			if err != nil {
+				return 0, err
+			}
+			begin -= size
+		}
+
+		if j < start {
+			start = j
 		}
-		d.buf = d.buf[d.pos:]
 	}
 
-	return npos, nil
+	return start, nil
+}
+
+// reservoir returns main_data_begin of the frame at the index i,
+// which is the number of bytes of its main data in the previous frames,
+// and the number of bytes of main data in the frame.
+// Both are 0 for Layer I and II frames.
+func (d *Decoder) reservoir(i int64) (begin, size int, err error) {
+	// the header, the CRC and the start of the side info
+	b, err := d.source.readAt(d.frameStarts[i], 8)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the frame is truncated, which is found by reading it
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	h := frameheader.FrameHeader(binary.BigEndian.Uint32(b))
+	if h.Layer() != consts.Layer3 {
+		return 0, 0, nil
+	}
+
+	framesize, err := d.source.frameSize(h)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size = framesize - 4 - h.SideInfoSize()
+	si := b[4:]
+	if h.ProtectionBit() == 0 {
+		size -= 2
+		si = b[6:]
+	}
+
+	if h.LowSamplingFrequency() == 1 {
+		// main_data_begin is 8 bits
+		return int(si[0]), size, nil
+	}
+
+	// main_data_begin is 9 bits
+	return int(si[0])<<1 | int(si[1])>>7, size, nil
 }
 
 // Read is io.Reader's Read.
 func (d *Decoder) Read(buf []byte) (int, error) {
-	for len(d.buf) == 0 {
-		if err := d.readFrame(); err != nil {
-			return 0, err
+	// leave out the encoder padding
+	n, err := d.prepare()
+	if err != nil {
+		return 0, err
+	}
+
+	if int64(len(buf)) > n {
+		buf = buf[:n]
+	}
+
+	read := copy(buf, d.buf)
+	d.buf = d.buf[read:]
+
+	bps := int(d.bytesPerSample())
+	samples := (len(buf) - read) / bps
+	if samples > d.samples() {
+		samples = d.samples()
+	}
+	d.encode(buf[read:], samples)
+	read += samples * bps
+
+	if read < len(buf) && d.samples() > 0 {
+		// the rest of the sample is read later
+		d.buf = make([]byte, bps)
+		d.encode(d.buf, 1)
+		m := copy(buf[read:], d.buf)
+		d.buf = d.buf[m:]
+		read += m
+	}
+
+	d.pos += int64(read)
+	return read, nil
+}
+
+func (d *Decoder) readFrame() error {
+	pos, err := d.nextFrame()
+	if err == io.EOF && d.end > d.length && d.frame != nil && !d.flushed {
+		// the synthesis delays the last samples past the last frame,
+		// which are flushed out with a frame of silence
+		d.flushed = true
+		d.appendFrame(d.frame.Silence())
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return d.decodeFrame(pos)
+}
+
+// decodeFrame decodes d.frame read at the position pos,
+// or conceals it if it can't be decoded.
+func (d *Decoder) decodeFrame(pos int64) error {
+	err := d.frame.Err()
+	if err == nil && !d.frame.CRCValid() {
+		switch d.crcPolicy {
+		case CRCConceal:
+			err = &CRCError{Offset: pos}
+		case CRCFail:
+			return &CRCError{Offset: pos}
 		}
 	}
 
-	n := copy(buf, d.buf)
-	d.buf = d.buf[n:]
-	d.pos += int64(n)
-	return n, nil
+	if err != nil {
+		return d.conceal(pos, err)
+	}
+
+	d.appendFrame(d.frame.Decode())
+	return nil
 }
 
-func (d *Decoder) readFrame() (err error) {
-	d.frame, _, err = frame.Read(d.source, d.source.pos, d.frame)
+// nextFrame reads the next frame into d.frame without decoding it
+// and returns its position. d.frame is left as it is on errors.
+func (d *Decoder) nextFrame() (pos int64, err error) {
+	if d.next != nil {
+		d.frame, pos = d.next, d.nextPos
+		d.next = nil
+		return pos, nil
+	}
+
+	var f *frame.Frame
+	if d.nextErr != nil {
+		err, d.nextErr = d.nextErr, nil
+	} else if d.seekHeader != 0 {
+		f, pos, err = frame.ReadStart(d.source, d.source.pos, d.seekHeader)
+		d.seekHeader = 0
+	} else {
+		f, pos, err = frame.Read(d.source, d.source.pos, d.frame)
+	}
+
 	if err != nil {
 		if err == io.EOF {
-			return io.EOF
+			return 0, io.EOF
 		}
 
 		if _, ok := err.(*consts.UnexpectedEOF); ok {
-			return io.EOF
+			return 0, io.EOF
 		}
 
-		return err
+		return 0, err
 	}
 
-	d.buf = append(d.buf, d.frame.Decode()...)
-	return nil
+	d.frame = f
+	return pos, nil
 }
 
 func (d *Decoder) ensureFrameStartsAndLength() error {
-	if d.length != invalidLength {
+	if d.frameStarts != nil {
 		return nil
 	}
 
@@ -168,23 +607,29 @@ func (d *Decoder) ensureFrameStartsAndLength() error {
 		return nil
 	}
 
-	// keep the current position
-	pos, err := d.source.Seek(0, io.SeekCurrent)
-	if err != nil {
+	// keep the current position,
+	// which is behind the reader's one if data has been unread
+	pos := d.source.pos
+	if err := d.source.rewind(); err != nil {
 		return err
 	}
 
-	if err = d.source.rewind(); err != nil {
-		return err
-	}
+	// the tags found while scanning are not reported
+	onID3v2 := d.source.onID3v2
+	d.source.onID3v2 = nil
+	defer func() {
+		d.source.onID3v2 = onID3v2
+	}()
 
-	if err = d.source.skipTags(); err != nil {
+	if err := d.source.skipTags(); err != nil {
 		return err
 	}
 
 	var l int64
+	var samples []int64
+	var prev frameheader.FrameHeader
 	for {
-		h, pos, err := frameheader.Read(d.source, d.source.pos)
+		h, pos, err := frameheader.Read(d.source, d.source.pos, prev)
 		if err != nil {
 			if err == io.EOF {
 				break
@@ -196,12 +641,16 @@ func (d *Decoder) ensureFrameStartsAndLength() error {
 
 			return err
 		}
+		prev = h
 
-		d.frameStarts = append(d.frameStarts, pos)
-		d.bytesPerFrame = int64(h.BytesPerFrame())
-		l += d.bytesPerFrame
+		// the frame with the VBR header is not audio
+		if pos != d.firstFramePos || !d.hasVBRHeader() {
+			d.frameStarts = append(d.frameStarts, pos)
+			samples = append(samples, l/d.bytesPerSample())
+			l += int64(h.SamplesPerFrame()) * d.bytesPerSample()
+		}
 
-		framesize, err := h.FrameSize()
+		framesize, err := d.source.frameSize(h)
 		if err != nil {
 			return err
 		}
@@ -214,7 +663,10 @@ func (d *Decoder) ensureFrameStartsAndLength() error {
 			return err
 		}
 	}
-	d.length = l
+	d.frameSamples = append(samples, l/d.bytesPerSample())
+	if d.length == invalidLength {
+		d.length = l
+	}
 
 	if _, err := d.source.Seek(pos, io.SeekStart); err != nil {
 		return err
@@ -222,3 +674,130 @@ func (d *Decoder) ensureFrameStartsAndLength() error {
 
 	return nil
 }
+
+// readVBRHeader reads the Xing or VBRI header in the first frame
+// if there is one. As the frame with the header is not audio,
+// the source is left after the frame if there is a header,
+// or at the start of the first frame otherwise.
+func (d *Decoder) readVBRHeader() error {
+	h, pos, err := frameheader.Read(d.source, d.source.pos, 0)
+	if err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+
+		if _, ok := err.(*consts.UnexpectedEOF); ok {
+			return io.EOF
+		}
+
+		return err
+	}
+
+	framesize, err := d.source.frameSize(h)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+framesize)
+	binary.BigEndian.PutUint32(buf, uint32(h))
+	n, err := d.source.ReadFull(buf[4:framesize])
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	d.firstFramePos = pos
+	d.firstFrameSize = framesize
+	d.channels = 2
+	if d.nativeChannels {
+		d.channels = h.NumberOfChannels()
+	}
+	d.bytesPerFrame = int64(h.SamplesPerFrame()) * d.bytesPerSample()
+	d.xing = parseXing(h, buf[4:4+n])
+	if d.xing == nil {
+		d.vbri = parseVBRI(h, buf[4:4+n])
+	}
+
+	if !d.hasVBRHeader() {
+		d.source.Unread(buf[:4+n])
+	}
+	return nil
+}
+
+// seekTOC seeks to about the position d.pos with the table of contents
+// of the Xing or VBRI header.
+func (d *Decoder) seekTOC() error {
+	// the first frames are read from the start,
+	// which is exact and needs no previous frame
+	f := d.pos / d.bytesPerFrame
+	if f < 3 {
+		audioPos := d.firstFramePos + int64(d.firstFrameSize)
+		if _, err := d.source.Seek(audioPos, io.SeekStart); err != nil {
+			return err
+		}
+
+		for d.buffered() <= d.pos {
+			if err := d.readFrame(); err != nil {
+				return err
+			}
+		}
+		d.skip(d.pos)
+		return nil
+	}
+
+	// aim at the middle of the frame three before the targeted one
+	// so that the next frame found is the one two before the targeted one
+	pos := (f-2)*d.bytesPerFrame - d.bytesPerFrame/2
+	target := d.firstFramePos + d.tocOffset(pos)
+	// the frames before are read without decoding
+	// to fill the bit reservoir
+	start := target - reservoirBytes
+	if audioPos := d.firstFramePos + int64(d.firstFrameSize); start < audioPos {
+		start = audioPos
+	}
+
+	if _, err := d.source.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	// as the position is not a frame start, the next frame from it
+	// is the one two before the targeted one, which is decoded ahead
+	// with the next as the previous frames can affect the targeted one
+	for {
+		pos, err := d.nextFrame()
+		if err != nil {
+			return err
+		}
+
+		if pos >= target {
+			if err := d.decodeFrame(pos); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	if err := d.readFrame(); err != nil {
+		return err
+	}
+	d.pcm = nil
+
+	if err := d.readFrame(); err != nil {
+		return err
+	}
+	d.skip(d.pos % d.bytesPerFrame)
+	return nil
+}
+
+// tocOffset returns the offset in bytes from the first frame
+// of about the position pos with the table of contents.
+func (d *Decoder) tocOffset(pos int64) int64 {
+	if d.xing == nil {
+		// the frame with the VBRI header is not in its table of contents
+		frames := float64(pos) / float64(d.bytesPerFrame)
+		return int64(d.firstFrameSize) + d.vbri.seekOffset(frames)
+	}
+
+	// the size is of the audio without the trailing tags
+	size := d.source.end - d.firstFramePos
+	return d.xing.seekOffset(float64(pos)/float64(d.length), size)
+}
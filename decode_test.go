@@ -2,9 +2,17 @@ package mp3
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/pchchv/mp3/id3"
 )
 
 func TestFuzzing(t *testing.T) {
@@ -94,6 +102,1836 @@ func TestFuzzing(t *testing.T) {
 	}
 }
 
+// silentFrames returns n frames with the given header word whose
+// remaining bytes are all zero, so they decode to silence.
+func silentFrames(header uint32, size int, n int) []byte {
+	var buf []byte
+	for i := 0; i < n; i++ {
+		f := make([]byte, size)
+		f[0], f[1], f[2], f[3] = byte(header>>24), byte(header>>16), byte(header>>8), byte(header)
+		buf = append(buf, f...)
+	}
+	return buf
+}
+
+// bitWriter writes the fields of hand-built frames,
+// the most significant bit first.
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+// write writes the n low bits of v.
+func (w *bitWriter) write(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[w.n/8] |= byte(v>>uint(i)&1) << uint(7-w.n%8)
+		w.n++
+	}
+}
+
+// writeString writes the bits of a string of 0s and 1s.
+func (w *bitWriter) writeString(s string) {
+	for _, c := range s {
+		w.write(int(c-'0'), 1)
+	}
+}
+
+// frame returns the header word followed by the bits written
+// and zeros up to size bytes.
+func (w *bitWriter) frame(header uint32, size int) []byte {
+	f := make([]byte, size)
+	binary.BigEndian.PutUint32(f, header)
+	copy(f[4:], w.buf)
+	return f
+}
+
+// lsfFrame returns an MPEG-2 or MPEG-2.5 Layer III mono frame whose granule
+// has bigValues pairs of values coded in huffman, a string of 0s and 1s,
+// with the tables of each region. Region 0 of long blocks ends with the
+// scalefactor band region0+1 and region 1 with the band region0+region1+2,
+// region 0 of short blocks ends with the short scalefactor band 3.
+func lsfFrame(header uint32, size int, short bool, tables [3]int, region0, region1, bigValues int, huffman string) []byte {
+	var w bitWriter
+	w.write(0, 8) // main_data_begin
+	w.write(0, 1) // private_bits
+	w.write(len(huffman), 12)
+	w.write(bigValues, 9)
+	w.write(230, 8) // global_gain
+	w.write(0, 9)   // scalefac_compress, without scalefactors
+	if short {
+		w.write(1, 1) // window_switching_flag
+		w.write(2, 2) // block_type
+		w.write(0, 1) // mixed_block_flag
+		w.write(tables[0], 5)
+		w.write(tables[1], 5)
+		w.write(0, 9) // subblock_gain
+	} else {
+		w.write(0, 1)
+		for _, t := range tables {
+			w.write(t, 5)
+		}
+		w.write(region0, 4)
+		w.write(region1, 3)
+	}
+	w.write(0, 1) // scalefac_scale
+	w.write(0, 1) // count1table_select
+	w.writeString(huffman)
+	return w.frame(header, size)
+}
+
+// lsfRegionFrames returns frames with a value at the first line of region 2
+// of long blocks, region 1 of long blocks and region 1 of short blocks,
+// whose starts are given. The lines before the value are coded with table 0,
+// which has no bits. want has the same values coded with table 1 from line 0,
+// so both decode to the same samples only if the regions start there.
+func lsfRegionFrames(header uint32, size int, region2, region1, short int) (src, want []byte) {
+	// the pair of 1 and 0 coded with table 1, and the pair of 0 and 0
+	const one, zero = "010", "1"
+	for _, c := range []struct {
+		short            bool
+		tables           [3]int
+		region0, region1 int
+		start            int
+	}{
+		{false, [3]int{0, 0, 1}, 3, 5, region2},
+		{false, [3]int{0, 1, 1}, 6, 0, region1},
+		{true, [3]int{0, 1}, 0, 0, short},
+	} {
+		bigValues := c.start/2 + 1
+		src = append(src, lsfFrame(header, size, c.short, c.tables, c.region0, c.region1, bigValues, one)...)
+		want = append(want, lsfFrame(header, size, c.short, [3]int{1, 1, 1}, c.region0, c.region1, bigValues,
+			strings.Repeat(zero, c.start/2)+one)...)
+	}
+	return
+}
+
+// quantCodes returns the codes of a quantizer of nlevels levels
+// that step through the levels.
+func quantCodes(step, nlevels int) func(int) int {
+	return func(n int) int {
+		return n * step % nlevels
+	}
+}
+
+// scaleCodes returns the codes of a quantizer of k times the levels
+// of one of nlevels levels, whose samples (2c-(n-1))/n are the same.
+func scaleCodes(c func(int) int, nlevels, k int) func(int) int {
+	return func(n int) int {
+		return (k*(2*c(n)-(nlevels-1)) + k*nlevels - 1) / 2
+	}
+}
+
+// layer1Subband is a subband of a channel of a hand-built Layer I frame.
+type layer1Subband struct {
+	sb, ch int
+	// alloc is the bit allocation, which is the bits of a code minus 1
+	alloc       int
+	scalefactor int
+	// code returns the code of the sample n of 12
+	code func(n int) int
+}
+
+// layer1Frame returns a Layer I frame with the subbands of the channels
+// that are given. Subbands from the bound upwards are shared by both
+// channels, whose allocation and samples are those of channel 0.
+func layer1Frame(header uint32, size, bound int, subbands []layer1Subband) []byte {
+	find := func(sb, ch int) *layer1Subband {
+		for i := range subbands {
+			if subbands[i].sb == sb && subbands[i].ch == ch {
+				return &subbands[i]
+			}
+		}
+		return nil
+	}
+
+	var w bitWriter
+	for sb := 0; sb < 32; sb++ {
+		for ch := 0; ch < 2; ch++ {
+			if sb >= bound && ch == 1 {
+				continue
+			}
+			alloc := 0
+			if s := find(sb, ch); s != nil {
+				alloc = s.alloc
+			}
+			w.write(alloc, 4)
+		}
+	}
+
+	for sb := 0; sb < 32; sb++ {
+		for ch := 0; ch < 2; ch++ {
+			if s := find(sb, ch); s != nil {
+				w.write(s.scalefactor, 6)
+			}
+		}
+	}
+
+	for n := 0; n < 12; n++ {
+		for sb := 0; sb < 32; sb++ {
+			for ch := 0; ch < 2; ch++ {
+				if s := find(sb, ch); s != nil && (sb < bound || ch == 0) {
+					w.write(s.code(n), s.alloc+1)
+				}
+			}
+		}
+	}
+	return w.frame(header, size)
+}
+
+const (
+	layer1Joint  = 0xffffe440 // MPEG-1 Layer I, 448 kbps, 48000 Hz, joint stereo
+	layer1Stereo = 0xffffe400
+	layer1Size   = 448
+)
+
+// layer1Frames returns a joint stereo Layer I frame with quantizers of 3, 7
+// and 15 levels and a subband above the bound, and a stereo frame with
+// the same samples of quantizers whose levels are multiples of the others.
+func layer1Frames() (src, want []byte) {
+	c0, c2, c5 := quantCodes(1, 3), quantCodes(3, 7), quantCodes(4, 15)
+	src = layer1Frame(layer1Joint, layer1Size, 4, []layer1Subband{
+		{0, 0, 1, 4, c0},
+		{2, 1, 2, 9, c2},
+		{5, 0, 3, 6, c5},
+		{5, 1, 3, 12, c5},
+	})
+	want = layer1Frame(layer1Stereo, layer1Size, 32, []layer1Subband{
+		{0, 0, 3, 4, scaleCodes(c0, 3, 5)},
+		{2, 1, 5, 9, scaleCodes(c2, 7, 9)},
+		{5, 0, 3, 6, c5},
+		{5, 1, 3, 12, c5},
+	})
+	return
+}
+
+// layer2Subband is a subband of a channel of a hand-built Layer II frame.
+type layer2Subband struct {
+	sb, ch int
+	// alloc is the bit allocation of a quantizer of nlevels levels,
+	// whose codes are of bits bits or, if grouped, 3 codes are
+	alloc   int
+	nlevels int
+	bits    int
+	grouped bool
+	scfsi   int
+	// scalefactors are the scalefactors transmitted
+	scalefactors []int
+	// code returns the code of the sample n of 36
+	code func(n int) int
+}
+
+// layer2Frame returns an MPEG-1 Layer II frame of 48000 Hz and a bitrate of
+// 80 kbps or more per channel, which has the allocation table B.2a, with the
+// subbands of the channels that are given. Subbands from the bound upwards
+// are shared by both channels, whose allocation and samples are those of
+// channel 0.
+func layer2Frame(header uint32, size, bound int, subbands []layer2Subband) []byte {
+	find := func(sb, ch int) *layer2Subband {
+		for i := range subbands {
+			if subbands[i].sb == sb && subbands[i].ch == ch {
+				return &subbands[i]
+			}
+		}
+		return nil
+	}
+
+	var w bitWriter
+	for sb := 0; sb < 27; sb++ {
+		nbal := 2
+		switch {
+		case sb < 11:
+			nbal = 4
+		case sb < 23:
+			nbal = 3
+		}
+		for ch := 0; ch < 2; ch++ {
+			if sb >= bound && ch == 1 {
+				continue
+			}
+			alloc := 0
+			if s := find(sb, ch); s != nil {
+				alloc = s.alloc
+			}
+			w.write(alloc, nbal)
+		}
+	}
+
+	for sb := 0; sb < 27; sb++ {
+		for ch := 0; ch < 2; ch++ {
+			if s := find(sb, ch); s != nil {
+				w.write(s.scfsi, 2)
+			}
+		}
+	}
+
+	for sb := 0; sb < 27; sb++ {
+		for ch := 0; ch < 2; ch++ {
+			if s := find(sb, ch); s != nil {
+				for _, sf := range s.scalefactors {
+					w.write(sf, 6)
+				}
+			}
+		}
+	}
+
+	for gr := 0; gr < 12; gr++ {
+		for sb := 0; sb < 27; sb++ {
+			for ch := 0; ch < 2; ch++ {
+				s := find(sb, ch)
+				if s == nil || sb >= bound && ch == 1 {
+					continue
+				}
+				if s.grouped {
+					n := 3 * gr
+					w.write(s.code(n)+s.nlevels*(s.code(n+1)+s.nlevels*s.code(n+2)), s.bits)
+					continue
+				}
+				for i := 0; i < 3; i++ {
+					w.write(s.code(3*gr+i), s.bits)
+				}
+			}
+		}
+	}
+	return w.frame(header, size)
+}
+
+// layer2Frames returns a joint stereo Layer II frame with grouped quantizers
+// of 3, 5 and 9 levels, each scalefactor selection and a subband above
+// the bound, and a stereo frame with the same samples of quantizers
+// without grouping, whose levels are multiples of the others. layer1 are
+// 3 Layer I frames with the samples of the 3 parts of the frame, each of
+// which has its own scalefactors.
+func layer2Frames() (src, want, layer1 []byte) {
+	const (
+		joint  = 0xfffda440 // MPEG-1 Layer II, 192 kbps, 48000 Hz, joint stereo
+		stereo = 0xfffda400
+		size   = 576
+	)
+	c0, c3, c3r, c4 := quantCodes(7, 15), quantCodes(1, 3), quantCodes(2, 5), quantCodes(4, 9)
+
+	src = layer2Frame(joint, size, 4, []layer2Subband{
+		{0, 0, 3, 15, 4, false, 0, []int{1, 2, 3}, c0},
+		{3, 0, 1, 3, 5, true, 0, []int{10, 13, 16}, c3},
+		{3, 1, 2, 5, 7, true, 1, []int{20, 23}, c3r},
+		{4, 0, 4, 9, 10, true, 2, []int{5}, c4},
+		{4, 1, 4, 9, 10, true, 3, []int{8, 11}, c4},
+	})
+	want = layer2Frame(stereo, size, 32, []layer2Subband{
+		{0, 0, 3, 15, 4, false, 0, []int{1, 2, 3}, c0},
+		{3, 0, 5, 15, 4, false, 0, []int{10, 13, 16}, scaleCodes(c3, 3, 5)},
+		{3, 1, 5, 15, 4, false, 0, []int{20, 20, 23}, scaleCodes(c3r, 5, 3)},
+		{4, 0, 7, 63, 6, false, 0, []int{5, 5, 5}, scaleCodes(c4, 9, 7)},
+		{4, 1, 7, 63, 6, false, 0, []int{8, 11, 11}, scaleCodes(c4, 9, 7)},
+	})
+
+	for part := 0; part < 3; part++ {
+		shift := func(c func(int) int) func(int) int {
+			return func(n int) int {
+				return c(12*part + n)
+			}
+		}
+		layer1 = append(layer1, layer1Frame(layer1Stereo, layer1Size, 32, []layer1Subband{
+			{0, 0, 3, []int{1, 2, 3}[part], shift(c0)},
+			{3, 0, 1, []int{10, 13, 16}[part], shift(c3)},
+			{3, 1, 3, []int{20, 20, 23}[part], shift(scaleCodes(c3r, 5, 3))},
+			{4, 0, 5, 5, shift(scaleCodes(c4, 9, 7))},
+			{4, 1, 5, []int{8, 11, 11}[part], shift(scaleCodes(c4, 9, 7))},
+		})...)
+	}
+	return
+}
+
+func TestStreams(t *testing.T) {
+	// MPEG-2 Layer III, 32 kbps, 24000 Hz, mono, whose frames are 96 bytes
+	// and 97 bytes with the padding slot, which is not halved with the frame
+	var padded []byte
+	for i := 0; i < 8; i++ {
+		if i%2 == 0 {
+			padded = append(padded, silentFrames(0xfff344c0, 96, 1)...)
+		} else {
+			padded = append(padded, silentFrames(0xfff346c0, 97, 1)...)
+		}
+	}
+
+	// MPEG-2.5 Layer III, 64 kbps, mono, whose scalefactor bands
+	// of 11025 Hz and 12000 Hz are those of MPEG-2, but not of 8000 Hz
+	src11025, want11025 := lsfRegionFrames(0xffe380c0, 417, 80, 44, 36)
+	src12000, want12000 := lsfRegionFrames(0xffe384c0, 384, 80, 44, 36)
+	src8000, want8000 := lsfRegionFrames(0xffe388c0, 576, 160, 88, 72)
+
+	layer2, layer2Want, layer2Parts := layer2Frames()
+	layer1, layer1Want := layer1Frames()
+
+	// the Layer II frames with no bitrate in the header, whose size is found
+	// with the next header
+	var free []byte
+	for i := 0; i < 8; i++ {
+		f := append([]byte(nil), layer2...)
+		f[2] &^= 0xf0
+		free = append(free, f...)
+	}
+
+	// MPEG-1 Layer III, free format, 44100 Hz, mono, with the header of
+	// the stream by chance in the data of the first frame, which is not
+	// followed by another one at the same distance
+	falseHeader := silentFrames(0xfffb00c0, 1000, 8)
+	binary.BigEndian.PutUint32(falseHeader[400:], 0xfffb00c0)
+
+	tests := []struct {
+		name       string
+		src        []byte
+		sampleRate int
+		// samples is the number of samples per channel
+		samples int
+		// want is the stream of the same samples coded otherwise,
+		// which src must decode to
+		want []byte
+	}{
+		{"MPEG-2.5 11025 Hz", src11025, 11025, 3 * 576, want11025},
+		{"MPEG-2.5 12000 Hz", src12000, 12000, 3 * 576, want12000},
+		{"MPEG-2.5 8000 Hz", src8000, 8000, 3 * 576, want8000},
+		{"MPEG-2.5 silence", silentFrames(0xffe388c0, 576, 8), 8000, 8 * 576, nil},
+		{"MPEG-2 padding", padded, 24000, 8 * 576, nil},
+		{"Layer II", bytes.Repeat(layer2, 4), 48000, 4 * 1152, bytes.Repeat(layer2Want, 4)},
+		{"MPEG-2 Layer II silence", silentFrames(0xfff58040, 417, 8), 22050, 8 * 1152, nil},
+		{"Layer I", bytes.Repeat(layer1, 4), 48000, 4 * 384, bytes.Repeat(layer1Want, 4)},
+		{"Layer II as Layer I", bytes.Repeat(layer2, 2), 48000, 2 * 1152, bytes.Repeat(layer2Parts, 2)},
+		// MPEG-1, 448 kbps, mono, whose padding slot is 4 bytes
+		{"Layer I padding", silentFrames(0xffffe2c0, 488, 8), 44100, 8 * 384, nil},
+		{"MPEG-2 Layer I silence", silentFrames(0xfff7e840, 768, 8), 16000, 8 * 384, nil},
+		{"free format", free, 48000, 8 * 1152, bytes.Repeat(layer2, 8)},
+		{"free format Layer III mono", silentFrames(0xfffb00c0, 1000, 8), 44100, 8 * 1152, nil},
+		// 640 kbps, more than the bitrates in the table
+		{"free format Layer III stereo", silentFrames(0xfffb0000, 2089, 8), 44100, 8 * 1152, nil},
+		{"free format false header", falseHeader, 44100, 8 * 1152, nil},
+	}
+	// streams too short to have the frames that confirm the first header
+	for n := 1; n <= 3; n++ {
+		tests = append(tests, []struct {
+			name       string
+			src        []byte
+			sampleRate int
+			samples    int
+			want       []byte
+		}{
+			{fmt.Sprintf("free format of %d frames", n), free[:n*len(layer2)], 48000, n * 1152, bytes.Repeat(layer2, n)},
+			{fmt.Sprintf("free format Layer III of %d frames", n), silentFrames(0xfffb00c0, 1000, n), 44100, n * 1152, nil},
+		}...)
+	}
+	for _, tt := range tests {
+		d, err := NewDecoder(bytes.NewReader(tt.src))
+		if err != nil {
+			t.Fatalf("%s: NewDecoder: %v", tt.name, err)
+		}
+
+		if got := d.SampleRate(); got != tt.sampleRate {
+			t.Errorf("%s: SampleRate(): got %d, want %d", tt.name, got, tt.sampleRate)
+		}
+
+		if got, want := d.Length(), int64(tt.samples*4); got != want {
+			t.Errorf("%s: Length(): got %d, want %d", tt.name, got, want)
+		}
+
+		out, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if len(out) != tt.samples*4 {
+			t.Errorf("%s: len(out): got %d, want %d", tt.name, len(out), tt.samples*4)
+		}
+
+		if tt.want == nil {
+			continue
+		}
+
+		d, err = NewDecoder(bytes.NewReader(tt.want))
+		if err != nil {
+			t.Fatalf("%s: NewDecoder: %v", tt.name, err)
+		}
+
+		want, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if bytes.Equal(want, make([]byte, len(want))) {
+			t.Errorf("%s: the samples are silent", tt.name)
+		}
+
+		if !bytes.Equal(out, want) {
+			t.Errorf("%s: the samples differ from those of the same values coded otherwise", tt.name)
+		}
+	}
+}
+
+// xingFrame returns a frame with the given header word that has a Xing
+// header with a linear table of contents after a side info of siSize bytes.
+func xingFrame(header uint32, size, siSize int, frames, bytes uint32) []byte {
+	f := silentFrames(header, size, 1)
+	b := f[4+siSize:]
+	copy(b, "Xing")
+	binary.BigEndian.PutUint32(b[4:], 0xf)
+	binary.BigEndian.PutUint32(b[8:], frames)
+	binary.BigEndian.PutUint32(b[12:], bytes)
+	for i := 0; i < 100; i++ {
+		b[16+i] = byte(i * 256 / 100)
+	}
+	binary.BigEndian.PutUint32(b[116:], 50)
+	return f
+}
+
+func TestXing(t *testing.T) {
+	const (
+		header = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size   = 417
+		n      = 100
+	)
+	src := append(xingFrame(header, size, 17, n, (n+1)*size), silentFrames(header, size, n)...)
+
+	// the length is known even if the source is not io.Seeker
+	d, err := NewDecoder(struct{ io.Reader }{bytes.NewReader(src)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := d.Xing()
+	if x == nil {
+		t.Fatal("Xing(): got nil")
+	}
+
+	if x.Tag != "Xing" || x.Frames != n || x.Bytes != (n+1)*size || len(x.TOC) != 100 || x.Quality != 50 {
+		t.Errorf("Xing(): got %+v", x)
+	}
+
+	want := int64(n * 1152 * 4)
+	if got := d.Length(); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	d, err = NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the TOC is used to seek without reading the whole stream
+	if _, err := d.Seek(want/2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.frameStarts != nil {
+		t.Errorf("frameStarts: got %d frames, want nil", len(d.frameStarts))
+	}
+
+	// a negative position is an error that leaves the position as it is
+	pos, err := d.Seek(0, io.SeekCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		offset int64
+		whence int
+	}{
+		{-1, io.SeekStart},
+		{-pos - 1, io.SeekCurrent},
+		{-want - 1, io.SeekEnd},
+	} {
+		if _, err := d.Seek(c.offset, c.whence); err == nil {
+			t.Errorf("Seek(%d, %d): got no error", c.offset, c.whence)
+		}
+	}
+
+	if got, err := d.Seek(0, io.SeekCurrent); err != nil || got != pos {
+		t.Errorf("Seek(0, io.SeekCurrent) after the errors: got %d, %v, want %d", got, err, pos)
+	}
+
+	out, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// seeking with the TOC is approximate
+	if got, diff := int64(len(out)), int64(2*1152*4); got < want/2-diff || got > want/2+diff {
+		t.Errorf("len(out) after seeking to the middle: got %d, want about %d", got, want/2)
+	}
+
+	// the frame with the Xing header is not counted when the stream is scanned
+	src = append(xingFrame(header, size, 17, 0, 0), silentFrames(header, size, n)...)
+	d, err = NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.Length(); got != want {
+		t.Errorf("Length() without the frame count: got %d, want %d", got, want)
+	}
+
+	if got := len(d.frameStarts); got != n {
+		t.Errorf("frameStarts: got %d frames, want %d", got, n)
+	}
+
+	out, err = io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := int64(len(out)); got != want {
+		t.Errorf("len(out): got %d, want %d", got, want)
+	}
+}
+
+// vbriFrame returns a silent frame with a VBRI header whose table of contents
+// has an entry of 2 bytes for each 2 frames.
+func vbriFrame(header uint32, size int, frames, frameSize int) []byte {
+	f := silentFrames(header, size, 1)
+	b := f[4+32:]
+	copy(b, "VBRI")
+	binary.BigEndian.PutUint16(b[4:], 1)
+	binary.BigEndian.PutUint16(b[6:], 1105)
+	binary.BigEndian.PutUint16(b[8:], 75)
+	binary.BigEndian.PutUint32(b[10:], uint32((frames+1)*frameSize))
+	binary.BigEndian.PutUint32(b[14:], uint32(frames))
+	binary.BigEndian.PutUint16(b[18:], uint16(frames/2))
+	binary.BigEndian.PutUint16(b[20:], 2)
+	binary.BigEndian.PutUint16(b[22:], 2)
+	binary.BigEndian.PutUint16(b[24:], 2)
+	for i := 0; i < frames/2; i++ {
+		binary.BigEndian.PutUint16(b[26+2*i:], uint16(frameSize))
+	}
+	return f
+}
+
+func TestVBRI(t *testing.T) {
+	const (
+		header = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size   = 417
+		n      = 100
+	)
+	src := append(vbriFrame(header, size, n, size), silentFrames(header, size, n)...)
+
+	// the length is known even if the source is not io.Seeker
+	d, err := NewDecoder(struct{ io.Reader }{bytes.NewReader(src)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := d.VBRI()
+	if v == nil {
+		t.Fatal("VBRI(): got nil")
+	}
+
+	if v.Version != 1 || v.Delay != 1105 || v.Quality != 75 || v.Frames != n || v.Bytes != (n+1)*size ||
+		v.Scale != 2 || v.EntrySize != 2 || v.FramesPerEntry != 2 || len(v.TOC) != n/2 || v.TOC[0] != 2*size {
+		t.Errorf("VBRI(): got %+v", v)
+	}
+
+	want := int64(n * 1152 * 4)
+	if got := d.Length(); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	d, err = NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the TOC is used to seek without reading the whole stream
+	if _, err := d.Seek(want/2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.frameStarts != nil {
+		t.Errorf("frameStarts: got %d frames, want nil", len(d.frameStarts))
+	}
+
+	out, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, diff := int64(len(out)), int64(2*1152*4); got < want/2-diff || got > want/2+diff {
+		t.Errorf("len(out) after seeking to the middle: got %d, want about %d", got, want/2)
+	}
+}
+
+func TestGapless(t *testing.T) {
+	const (
+		header  = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size    = 417
+		n       = 10
+		delay   = 576
+		padding = 1000
+	)
+	x := xingFrame(header, size, 17, n, (n+1)*size)
+	lame := x[4+17+120:]
+	copy(lame, "LAME3.100")
+	lame[21] = delay >> 4
+	lame[22] = delay&0xf<<4 | padding>>8
+	lame[23] = padding & 0xff
+	src := append(x, silentFrames(header, size, n)...)
+
+	d, err := NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := d.Xing().LAME
+	if l == nil {
+		t.Fatal("Xing().LAME: got nil")
+	}
+
+	if l.Encoder != "LAME3.100" || l.EncoderDelay != delay || l.Padding != padding {
+		t.Errorf("Xing().LAME: got %+v", l)
+	}
+
+	want := int64((n*1152 - delay - padding) * 4)
+	if got := d.Length(); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	out, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := int64(len(out)); got != want {
+		t.Errorf("len(out): got %d, want %d", got, want)
+	}
+
+	if _, err := d.Seek(want-400, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(out); got != 400 {
+		t.Errorf("len(out) after seeking: got %d, want %d", got, 400)
+	}
+
+	d, err = NewDecoder(bytes.NewReader(src), WithGapless(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := d.Length(), int64(n*1152*4); got != want {
+		t.Errorf("Length() without gapless: got %d, want %d", got, want)
+	}
+}
+
+func TestGaplessShortPadding(t *testing.T) {
+	example, err := os.ReadFile("examples/mpeg2.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewFrameReader(bytes.NewReader(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// frames from the middle of the example that end in the sound
+	const (
+		n       = 50
+		delay   = 576
+		padding = 100
+	)
+	var frames []byte
+	for i := 0; i < 100+n; i++ {
+		f, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= 100 {
+			frames = append(frames, f.Data...)
+		}
+	}
+
+	// MPEG-2 Layer III, 64 kbps, 22050 Hz, mono, which has room for the LAME header
+	x := xingFrame(0xfff380c4, 208, 9, n, uint32(208+len(frames)))
+	lame := x[4+9+120:]
+	copy(lame, "LAME3.100")
+	lame[21] = delay >> 4
+	lame[22] = delay&0xf<<4 | padding>>8
+	lame[23] = padding & 0xff
+	src := append(x, frames...)
+
+	// the padding is shorter than the decoder delay, so the last samples
+	// are those that a frame of silence after the last frame flushes out
+	ref, err := NewDecoder(bytes.NewReader(append(frames, silentFrames(0xfff360c4, 156, 1)...)), WithGapless(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := io.ReadAll(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := (delay + decoderDelay) * 4
+	want := all[start : start+(n*576-delay-padding)*4]
+
+	d, err := NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := d.Length(), int64(len(want)); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	out, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(out, want) {
+		t.Errorf("the samples differ, len(out): got %d, want %d", len(out), len(want))
+	}
+
+	tail := want[len(want)-(decoderDelay-padding)*4:]
+	if bytes.Equal(tail, make([]byte, len(tail))) {
+		t.Errorf("the samples after the last frame are silent")
+	}
+
+	// the samples after the last frame are found by seeking as well
+	if _, err := d.Seek(int64(len(want)-400), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(out, want[len(want)-400:]) {
+		t.Errorf("the samples after seeking differ, len(out): got %d, want %d", len(out), 400)
+	}
+}
+
+func TestID3v2(t *testing.T) {
+	const (
+		header = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size   = 417
+		n      = 10
+	)
+	// a version 2.4 tag with a footer
+	frame := append([]byte("TIT2\x00\x00\x00\x06\x00\x00"), "\x03Title"...)
+	frame = append(frame, "APIC\x00\x00\x00\x12\x00\x00\x00image/jpeg\x00\x03\x00\xff\xd8\xff\xe0"...)
+	tag := append([]byte("ID3\x04\x00\x10\x00\x00\x00"), byte(len(frame)))
+	tag = append(tag, frame...)
+	tag = append(tag, "3DI\x04\x00\x10\x00\x00\x00"...)
+	tag = append(tag, byte(len(frame)))
+	src := append(tag, silentFrames(header, size, n)...)
+
+	d, err := NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tag is not read until it is needed
+	if d.source.id3v2 != nil {
+		t.Errorf("the tag is read by NewDecoder")
+	}
+
+	if d.ID3v2() == nil {
+		t.Fatal("ID3v2(): got nil")
+	}
+
+	if got := d.ID3v2().Title(); got != "Title" {
+		t.Errorf("ID3v2().Title(): got %q", got)
+	}
+
+	if ps := d.ID3v2().Pictures(); len(ps) != 1 || ps[0].MIMEType != "image/jpeg" || len(ps[0].Data) != 4 {
+		t.Errorf("ID3v2().Pictures(): got %+v", ps)
+	}
+
+	if got, want := d.Length(), int64(n*1152*4); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+}
+
+func TestID3v1(t *testing.T) {
+	const (
+		header = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size   = 417
+		n      = 10
+	)
+	// the title looks like a frame header
+	tag := make([]byte, 128)
+	copy(tag, "TAG\xff\xfb\x90\xc0")
+	tag[127] = 17
+	src := append(silentFrames(header, size, n), tag...)
+
+	d, err := NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.ID3v1() == nil {
+		t.Fatal("ID3v1(): got nil")
+	}
+
+	if got := d.ID3v1().GenreName(); got != "Rock" {
+		t.Errorf("ID3v1().GenreName(): got %q", got)
+	}
+
+	want := int64(n * 1152 * 4)
+	if got := d.Length(); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	out, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := int64(len(out)); got != want {
+		t.Errorf("len(out): got %d, want %d", got, want)
+	}
+}
+
+// id3v2Tag returns a version 2.4 tag with the title
+// that is padded with data looking like a frame header.
+func id3v2Tag(title string, footer bool) []byte {
+	frame := append([]byte("TIT2\x00\x00\x00"), byte(len(title)+1), 0, 0, 3)
+	frame = append(frame, title...)
+	frame = append(frame, 0xff, 0xfb, 0x90, 0xc0)
+	flags := byte(0)
+	if footer {
+		flags = 0x10
+	}
+	tag := append([]byte{'I', 'D', '3', 4, 0, flags, 0, 0, 0}, byte(len(frame)))
+	tag = append(tag, frame...)
+	if footer {
+		tag = append(tag, '3', 'D', 'I', 4, 0, flags, 0, 0, 0, byte(len(frame)))
+	}
+	return tag
+}
+
+func TestID3v2BetweenFrames(t *testing.T) {
+	const (
+		header = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size   = 417
+		n      = 10
+	)
+	var src []byte
+	src = append(src, id3v2Tag("First", false)...)
+	src = append(src, id3v2Tag("Second", true)...)
+	src = append(src, silentFrames(header, size, n)...)
+	offset := int64(len(src))
+	src = append(src, id3v2Tag("Third", false)...)
+	src = append(src, silentFrames(header, size, n)...)
+	src = append(src, id3v2Tag("Appended", true)...)
+
+	var titles []string
+	var offsets []int64
+	d, err := NewDecoder(bytes.NewReader(src), WithID3v2Handler(func(tag *id3.Tag, offset int64) {
+		titles = append(titles, tag.Title())
+		offsets = append(offsets, offset)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.ID3v2().Title(); got != "First" {
+		t.Errorf("ID3v2().Title(): got %q", got)
+	}
+
+	want := int64(2 * n * 1152 * 4)
+	if got := d.Length(); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	out, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := int64(len(out)); got != want {
+		t.Errorf("len(out): got %d, want %d", got, want)
+	}
+
+	// the appended tag is reported first by NewDecoder
+	if want := []string{"Appended", "Second", "Third"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles: got %q, want %q", titles, want)
+	}
+
+	if len(offsets) > 2 && offsets[2] != offset {
+		t.Errorf("offset of the tag between frames: got %d, want %d", offsets[2], offset)
+	}
+}
+
+func TestSeekChapter(t *testing.T) {
+	const (
+		header = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size   = 417
+		n      = 50
+	)
+	// a chapter at the offset of the 5th frame and one at 1 second
+	chap := func(id string, start, offset uint32) []byte {
+		b := append([]byte(id), 0)
+		b = binary.BigEndian.AppendUint32(b, start)
+		b = binary.BigEndian.AppendUint32(b, start+1)
+		b = binary.BigEndian.AppendUint32(b, offset)
+		b = binary.BigEndian.AppendUint32(b, 0xffffffff)
+		return append([]byte{'C', 'H', 'A', 'P', 0, 0, 0, byte(len(b)), 0, 0}, b...)
+	}
+	const tagSize = 10 + 2*(10+4+16)
+	frames := append(chap("ch0", 0, tagSize+5*size), chap("ch1", 1000, 0xffffffff)...)
+	tag := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, byte(len(frames))}, frames...)
+	src := append(tag, silentFrames(header, size, n)...)
+
+	for _, c := range []struct {
+		id  string
+		pos int64
+	}{
+		{"ch0", 5 * 1152 * 4},
+		{"ch1", 44100 * 4},
+	} {
+		d, err := NewDecoder(bytes.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pos, err := d.SeekChapter(c.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pos != c.pos {
+			t.Errorf("SeekChapter(%q): got %d, want %d", c.id, pos, c.pos)
+		}
+
+		out, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := int64(len(out)), d.Length()-c.pos; got != want {
+			t.Errorf("len(out) after SeekChapter(%q): got %d, want %d", c.id, got, want)
+		}
+	}
+}
+
+func TestTrailingTags(t *testing.T) {
+	const (
+		header = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size   = 417
+		n      = 10
+	)
+	// an APEv2 tag with only a footer, whose value looks like a frame header
+	item := []byte("\x04\x00\x00\x00\x00\x00\x00\x00Title\x00\xff\xfb\x90\xc0")
+	footer := []byte("APETAGEX\xd0\x07\x00\x00")
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(item)+32))
+	footer = append(footer, 1, 0, 0, 0)
+	footer = append(footer, make([]byte, 12)...)
+	src := append(silentFrames(header, size, n), item...)
+	src = append(src, footer...)
+
+	// a Lyrics3v2 block with the size before the end marker
+	lyrics := "LYRICSBEGININD00003110LYR00005\xff\xfb\x90\xc0X"
+	src = append(src, fmt.Sprintf("%s%06dLYRICS200", lyrics, len(lyrics))...)
+	src = append(src, "TAG"...)
+	src = append(src, make([]byte, 125)...)
+
+	d, err := NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.APE() == nil {
+		t.Fatal("APE(): got nil")
+	}
+
+	if got := d.APE().Text("title"); got != "\xff\xfb\x90\xc0" {
+		t.Errorf("APE().Text(%q): got %q", "title", got)
+	}
+
+	want := int64(n * 1152 * 4)
+	if got := d.Length(); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	out, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := int64(len(out)); got != want {
+		t.Errorf("len(out): got %d, want %d", got, want)
+	}
+}
+
+func TestNativeChannels(t *testing.T) {
+	const n = 10
+	for _, c := range []struct {
+		name     string
+		header   uint32
+		size     int
+		channels int
+	}{
+		{"mono", 0xfffb90c0, 417, 1},
+		{"stereo", 0xfffb9000, 417, 2},
+	} {
+		src := silentFrames(c.header, c.size, n)
+		d, err := NewDecoder(bytes.NewReader(src), WithNativeChannels(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := d.Channels(); got != c.channels {
+			t.Errorf("%s: Channels(): got %d, want %d", c.name, got, c.channels)
+		}
+
+		want := int64(n * 1152 * 2 * c.channels)
+		if got := d.Length(); got != want {
+			t.Errorf("%s: Length(): got %d, want %d", c.name, got, want)
+		}
+
+		if _, err := d.Seek(want/2, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := int64(len(out)); got != want/2 {
+			t.Errorf("%s: len(out) after seeking to the middle: got %d, want %d", c.name, got, want/2)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	src, err := os.ReadFile("examples/mpeg2.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s16, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = NewDecoder(bytes.NewReader(src), WithFormat(FormatFloat32LE))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := d.Length(), int64(len(s16))*2; got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	// a buffer of an odd size splits samples
+	var f32 []byte
+	buf := make([]byte, 1001)
+	for {
+		n, err := d.Read(buf)
+		f32 = append(f32, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := len(f32), len(s16)*2; got != want {
+		t.Fatalf("len(f32): got %d, want %d", got, want)
+	}
+
+	d, err = NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make([]float32, 1000)
+	var i int
+	for {
+		n, err := d.ReadFloat32(values)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, v := range values[:n] {
+			if got, want := math.Float32frombits(binary.LittleEndian.Uint32(f32[4*i:])), v; got != want {
+				t.Fatalf("value %d: got %v, want %v", i, got, want)
+			}
+
+			s := int(v * 32767)
+			if s > 32767 {
+				s = 32767
+			} else if s < -32767 {
+				s = -32767
+			}
+			if got, want := int16(binary.LittleEndian.Uint16(s16[2*i:])), int16(s); got != want {
+				t.Fatalf("16-bit value %d: got %d, want %d", i, got, want)
+			}
+			i++
+		}
+	}
+
+	if got, want := i, len(s16)/2; got != want {
+		t.Errorf("ReadFloat32: got %d values, want %d", got, want)
+	}
+
+	d, err = NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	left := make([]float32, 700)
+	right := make([]float32, 500)
+	i = 0
+	for {
+		n, err := d.ReadPlanar(left, right)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j := 0; j < n; j++ {
+			for ch, v := range []float32{left[j], right[j]} {
+				if got, want := v, math.Float32frombits(binary.LittleEndian.Uint32(f32[4*(2*i+ch):])); got != want {
+					t.Fatalf("ReadPlanar: sample %d of channel %d: got %v, want %v", i, ch, got, want)
+				}
+			}
+			i++
+		}
+	}
+
+	if got, want := i, len(s16)/4; got != want {
+		t.Errorf("ReadPlanar: got %d samples, want %d", got, want)
+	}
+
+	if _, err := d.ReadPlanar(left); err == nil {
+		t.Error("ReadPlanar with 1 channel: got no error")
+	}
+}
+
+func TestIntegerFormats(t *testing.T) {
+	src, err := os.ReadFile("examples/mpeg2.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDecoder(bytes.NewReader(src), WithFormat(FormatFloat32LE))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f32, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make([]float64, len(f32)/4)
+	for i := range values {
+		values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(f32[4*i:])))
+	}
+
+	for _, c := range []struct {
+		name    string
+		options []Option
+		size    int
+		scale   float64
+		// maxErr is the maximum difference from the float value in LSB
+		maxErr float64
+	}{
+		{"s24", []Option{WithFormat(FormatS24LE)}, 3, 1<<23 - 1, 1},
+		{"s32", []Option{WithFormat(FormatS32LE)}, 4, 1<<31 - 1, 1},
+		{"tpdf", []Option{WithDither(DitherTPDF)}, 2, 1<<15 - 1, 1.5},
+		{"shaped", []Option{WithDither(DitherShaped)}, 2, 1<<15 - 1, 3},
+	} {
+		d, err := NewDecoder(bytes.NewReader(src), c.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := len(out), len(values)*c.size; got != want {
+			t.Fatalf("%s: len(out): got %d, want %d", c.name, got, want)
+		}
+
+		var sum float64
+		for i, v := range values {
+			b := make([]byte, 4)
+			copy(b[4-c.size:], out[c.size*i:c.size*(i+1)])
+			s := float64(int32(binary.LittleEndian.Uint32(b)) >> (8 * (4 - c.size)))
+
+			want := math.Max(-c.scale, math.Min(c.scale, v*c.scale))
+			if diff := math.Abs(s - want); diff > c.maxErr {
+				t.Fatalf("%s: value %d: got %v, want %v", c.name, i, s, want)
+			}
+			sum += s - want
+		}
+
+		// dither makes the error unbiased unlike truncation
+		if mean := sum / float64(len(values)); c.size == 2 && math.Abs(mean) > 0.05 {
+			t.Errorf("%s: the mean error: got %v, want about 0", c.name, mean)
+		}
+	}
+}
+
+func TestCRC(t *testing.T) {
+	const n = 8
+	for _, c := range []struct {
+		name    string
+		header  uint32
+		size    int
+		crc     uint16
+		samples int
+	}{
+		{"Layer III", 0xfffa9000, 417, 0xc05c, 1152},
+		{"Layer I", 0xfffee000, 484, 0x803c, 384},
+	} {
+		src := silentFrames(c.header, c.size, n)
+		for i := 0; i < n; i++ {
+			binary.BigEndian.PutUint16(src[i*c.size+4:], c.crc)
+		}
+		// the CRC of a frame in the middle doesn't match
+		const bad = 3
+		src[bad*c.size+5] ^= 0x01
+
+		r, err := NewFrameReader(bytes.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < n; i++ {
+			f, err := r.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !f.CRC {
+				t.Errorf("%s: frame %d: CRC: got false, want true", c.name, i)
+			}
+
+			if got, want := f.CRCValid, i != bad; got != want {
+				t.Errorf("%s: frame %d: CRCValid: got %v, want %v", c.name, i, got, want)
+			}
+		}
+
+		for _, p := range []CRCPolicy{CRCIgnore, CRCConceal} {
+			d, err := NewDecoder(bytes.NewReader(src), WithCRCPolicy(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := io.ReadAll(d)
+			if err != nil {
+				t.Fatalf("%s: policy %d: %v", c.name, p, err)
+			}
+
+			if got, want := len(out), n*c.samples*4; got != want {
+				t.Errorf("%s: policy %d: len(out): got %d, want %d", c.name, p, got, want)
+			}
+		}
+
+		d, err := NewDecoder(bytes.NewReader(src), WithCRCPolicy(CRCFail))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := io.ReadAll(d)
+		if got, want := len(out), bad*c.samples*4; got != want {
+			t.Errorf("%s: len(out) before the error: got %d, want %d", c.name, got, want)
+		}
+
+		e, ok := err.(*CRCError)
+		if !ok {
+			t.Fatalf("%s: got error %v, want *CRCError", c.name, err)
+		}
+
+		if got, want := e.Offset, int64(bad*c.size); got != want {
+			t.Errorf("%s: Offset: got %d, want %d", c.name, got, want)
+		}
+
+		// reading continues with the next frame
+		out, err = io.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := len(out), (n-bad-1)*c.samples*4; got != want {
+			t.Errorf("%s: len(out) after the error: got %d, want %d", c.name, got, want)
+		}
+	}
+}
+
+func TestConcealment(t *testing.T) {
+	src, err := os.ReadFile("examples/mpeg2.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewFrameReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the frame to break, which is counted without the frame with the VBR header
+	const bad = 100
+	var offset int64
+	for i := 0; i <= bad; i++ {
+		f, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.VBRHeader {
+			i--
+		}
+		offset = f.Offset
+	}
+
+	// big_values of the mono MPEG-2 frame that is too big to decode
+	broken := append([]byte{}, src...)
+	si := offset + 4
+	broken[si+2] |= 0x07
+	broken[si+3] |= 0xfc
+
+	d, err := NewDecoder(bytes.NewReader(src), WithGapless(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const frameSize = 576 * 4
+	d, err = NewDecoder(bytes.NewReader(broken), WithGapless(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := io.ReadAll(d)
+	if err == nil {
+		t.Fatal("ConcealNone: got no error")
+	}
+
+	if got, want := len(out), bad*frameSize; got != want {
+		t.Errorf("ConcealNone: len(out) before the error: got %d, want %d", got, want)
+	}
+
+	for _, c := range []Concealment{ConcealSilence, ConcealRepeat, ConcealInterpolate} {
+		var events []int64
+		d, err := NewDecoder(bytes.NewReader(broken), WithGapless(false), WithConcealment(c),
+			WithConcealmentHandler(func(offset int64, err error) {
+				events = append(events, offset)
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("concealment %d: %v", c, err)
+		}
+
+		if !reflect.DeepEqual(events, []int64{offset}) {
+			t.Errorf("concealment %d: events: got %v, want %v", c, events, []int64{offset})
+		}
+
+		if len(out) != len(want) {
+			t.Fatalf("concealment %d: len(out): got %d, want %d", c, len(out), len(want))
+		}
+
+		if !bytes.Equal(out[:bad*frameSize], want[:bad*frameSize]) {
+			t.Errorf("concealment %d: the frames before the broken one differ", c)
+		}
+
+		// the state of the synthesis is consistent and the main data of the
+		// broken frame is kept, so that only the overlap and the window of
+		// the synthesis carry the concealment over to the next frames
+		if i := (bad + 3) * frameSize; !bytes.Equal(out[i:], want[i:]) {
+			t.Errorf("concealment %d: the frames after the broken one differ", c)
+		}
+	}
+}
+
+func TestConcealmentReadError(t *testing.T) {
+	const (
+		header = 0xfffee000 // MPEG-1 Layer I, 448 kbps, 44100 Hz, stereo, with CRC
+		size   = 484
+		crc    = 0x803c
+		n      = 8
+		bad    = 3
+	)
+	src := silentFrames(header, size, n)
+	for i := 0; i < n; i++ {
+		binary.BigEndian.PutUint16(src[i*size+4:], crc)
+	}
+	// the frame whose CRC doesn't match is concealed,
+	// and the frame after it can't be read as its bit allocation is invalid
+	src[bad*size+5] ^= 0x01
+	src[(bad+1)*size+6] = 0xf0
+
+	const frameSize = 384 * 4
+	for _, c := range []Concealment{ConcealSilence, ConcealRepeat, ConcealInterpolate} {
+		var events []int64
+		d, err := NewDecoder(bytes.NewReader(src), WithCRCPolicy(CRCConceal), WithConcealment(c),
+			WithConcealmentHandler(func(offset int64, err error) {
+				events = append(events, offset)
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := io.ReadAll(d)
+		if err == nil {
+			t.Errorf("concealment %d: got no error", c)
+		}
+
+		if got, want := len(out), (bad+1)*frameSize; got != want {
+			t.Errorf("concealment %d: len(out) before the error: got %d, want %d", c, got, want)
+		}
+
+		if want := []int64{bad * size}; !reflect.DeepEqual(events, want) {
+			t.Errorf("concealment %d: events: got %v, want %v", c, events, want)
+		}
+
+		// reading again continues with the frame after the one that can't be read
+		out, err = io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("concealment %d: %v", c, err)
+		}
+
+		if got, want := len(out), (n-bad-2)*frameSize; got != want {
+			t.Errorf("concealment %d: len(out) after the error: got %d, want %d", c, got, want)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	const (
+		header = 0xfffb9000
+		size   = 417
+		n      = 8
+	)
+	frames := silentFrames(header, size, n)
+	// valid headers that are not followed by frames, with a bitrate and
+	// free-format
+	for _, h := range []string{"\xff\xfb\x90\x00", "\xff\xfb\x00\x00"} {
+		junk := make([]byte, 100)
+		copy(junk[10:], h)
+
+		var src []byte
+		var want []int64
+		for i := 0; i < n; i++ {
+			if i == 0 || i == 4 {
+				src = append(src, junk...)
+			}
+			want = append(want, int64(len(src)))
+			src = append(src, frames[i*size:(i+1)*size]...)
+		}
+
+		r, err := NewFrameReader(bytes.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []int64
+		for {
+			f, err := r.ReadFrame()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, f.Offset)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%x: offsets: got %v, want %v", h, got, want)
+		}
+
+		d, err := NewDecoder(bytes.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := d.Length(), int64(n*1152*4); got != want {
+			t.Errorf("%x: Length(): got %d, want %d", h, got, want)
+		}
+	}
+}
+
+func TestReservoir(t *testing.T) {
+	src, err := os.ReadFile("examples/mpeg2.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewFrameReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stream without the frame with the VBR header,
+	// which is seeked with the frame starts instead of its table of contents
+	var audio []byte
+	var begins, sizes []int
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.VBRHeader {
+			continue
+		}
+		audio = append(audio, f.Data...)
+		// main_data_begin of the mono MPEG-2 frame without CRC
+		// and the size of the main data after the 9 bytes of side info
+		begins = append(begins, int(f.Data[4]))
+		sizes = append(sizes, len(f.Data)-4-9)
+	}
+
+	d, err := NewDecoder(bytes.NewReader(audio), WithGapless(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first frames and the frames whose main data
+	// starts before the previous frame
+	const frameSize = 576 * 4
+	targets := []int{1, 2, 3}
+	var deep int
+	for f := 2; f < len(begins) && deep < 10; f++ {
+		if begins[f] > sizes[f-1] {
+			targets = append(targets, f)
+			deep++
+		}
+	}
+
+	if deep == 0 {
+		t.Fatal("no frame needs the main data of more than one previous frame")
+	}
+
+	out := make([]byte, 2*frameSize)
+	for _, f := range targets {
+		pos := int64(f * frameSize)
+		if _, err := d.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.ReadFull(d, out); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(out, want[pos:pos+int64(len(out))]) {
+			t.Errorf("the frames after seeking to the frame %d differ", f)
+		}
+	}
+
+	// a stream that is cut before a frame whose main data starts
+	// in the previous frames, which makes the frame silent
+	f := targets[3]
+	var offset int
+	for _, s := range sizes[:f] {
+		offset += 4 + 9 + s
+	}
+
+	d, err = NewDecoder(bytes.NewReader(audio[offset:]), WithGapless(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadFull(d, out[:frameSize]); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(out[:frameSize], make([]byte, frameSize)) {
+		t.Errorf("the frame without the bit reservoir is not silent")
+	}
+}
+
+func TestSeekSample(t *testing.T) {
+	src, err := os.ReadFile("examples/mpeg2.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDecoder(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make([]byte, 4096)
+	for _, n := range []int64{0, 1, 575, 576, 1000, 12345, 100000, d.Length()/4 - 2000} {
+		if err := d.SeekSample(n); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.ReadFull(d, out); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(out, want[n*4:n*4+int64(len(out))]) {
+			t.Errorf("SeekSample(%d): the samples differ", n)
+		}
+	}
+
+	// the samples at 1.5 s, which is rounded down
+	if err := d.SeekTime(1500 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadFull(d, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := int64(22050 * 3 / 2); !bytes.Equal(out, want[n*4:n*4+int64(len(out))]) {
+		t.Errorf("SeekTime(1.5s): the samples differ")
+	}
+
+	// a stream of MPEG-1 frames of 1152 samples around MPEG-2 frames of 576
+	// samples, which are the frames from the middle of the example
+	const (
+		header1 = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size1   = 417
+		frames2 = 16
+	)
+	r, err := NewFrameReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mixed := silentFrames(header1, size1, 4)
+	for i := 0; i < 100+frames2; i++ {
+		f, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= 100 {
+			mixed = append(mixed, f.Data...)
+		}
+	}
+	mixed = append(mixed, silentFrames(header1, size1, 4)...)
+
+	d, err = NewDecoder(bytes.NewReader(mixed), WithGapless(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const samples = 8*1152 + frames2*576
+	if got, want := d.Length(), int64(samples*4); got != want {
+		t.Errorf("Length(): got %d, want %d", got, want)
+	}
+
+	want, err = io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(want[4*1152*4:], make([]byte, len(want)-4*1152*4)) {
+		t.Fatal("the MPEG-2 frames are silent")
+	}
+
+	for _, n := range []int64{
+		0, 1152, 4*1152 + 100, 4*1152 + 5*576 + 1, 4*1152 + 12*576,
+		4*1152 + frames2*576, 4*1152 + frames2*576 + 1152, samples,
+	} {
+		if err := d.SeekSample(n); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(out, want[n*4:]) {
+			t.Errorf("SeekSample(%d): the samples differ", n)
+		}
+	}
+}
+
+func TestFrameReader(t *testing.T) {
+	const (
+		header = 0xfffb90c0 // MPEG-1 Layer III, 128 kbps, 44100 Hz, mono
+		size   = 417
+		n      = 10
+	)
+	tag := id3v2Tag("Title", false)
+	src := append(tag, xingFrame(header, size, 17, n, (n+1)*size)...)
+	src = append(src, silentFrames(header, size, n)...)
+	src = append(src, "TAG"...)
+	src = append(src, make([]byte, 125)...)
+
+	r, err := NewFrameReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frames []*Frame
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, f)
+	}
+
+	if len(frames) != n+1 {
+		t.Fatalf("got %d frames, want %d", len(frames), n+1)
+	}
+
+	for i, f := range frames {
+		offset := int64(len(tag) + i*size)
+		if f.Version != MPEG1 || f.Layer != 3 || f.Bitrate != 128000 || f.SampleRate != 44100 || f.Mode != ModeMono ||
+			f.Padding || f.CRC || f.Samples != 1152 || f.VBRHeader != (i == 0) || f.Offset != offset {
+			t.Errorf("frame %d: got %+v", i, *f)
+		}
+
+		if !bytes.Equal(f.Data, src[offset:offset+size]) {
+			t.Errorf("frame %d: data is different from the source", i)
+		}
+	}
+}
+
 func BenchmarkDecode(b *testing.B) {
 	buf, err := os.ReadFile("example/classic.mp3")
 	if err != nil {
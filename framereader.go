@@ -0,0 +1,193 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pchchv/mp3/internal/consts"
+	"github.com/pchchv/mp3/internal/frame"
+	"github.com/pchchv/mp3/internal/frameheader"
+)
+
+// Version is the MPEG version of a frame.
+type Version int
+
+const (
+	MPEG1 Version = iota
+	MPEG2
+	MPEG25
+)
+
+func (v Version) String() string {
+	switch v {
+	case MPEG1:
+		return "MPEG-1"
+	case MPEG2:
+		return "MPEG-2"
+	case MPEG25:
+		return "MPEG-2.5"
+	}
+	return "unknown"
+}
+
+// Mode is the channel mode of a frame.
+type Mode int
+
+const (
+	ModeStereo Mode = iota
+	ModeJointStereo
+	ModeDualChannel
+	ModeMono
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeStereo:
+		return "stereo"
+	case ModeJointStereo:
+		return "joint stereo"
+	case ModeDualChannel:
+		return "dual channel"
+	case ModeMono:
+		return "mono"
+	}
+	return "unknown"
+}
+
+// Frame is a raw MPEG audio frame.
+type Frame struct {
+	Version Version
+
+	// Layer is 1, 2 or 3.
+	Layer int
+
+	// Bitrate is the bitrate in bits per second,
+	// which is computed from the size for free-format frames.
+	Bitrate int
+
+	SampleRate int
+	Mode       Mode
+
+	// ModeExtension is the mode extension of joint stereo frames.
+	ModeExtension int
+
+	// Padding is whether the frame has a padding slot.
+	Padding bool
+
+	// CRC is whether the frame is protected by a CRC.
+	CRC bool
+
+	// CRCValid is whether the CRC matches the frame,
+	// which is always true when the frame has no CRC.
+	CRCValid bool
+
+	Copyright bool
+	Original  bool
+
+	// Emphasis is the emphasis, 0 for none, 1 for 50/15 ms
+	// and 3 for CCITT J.17.
+	Emphasis int
+
+	// Samples is the number of samples per channel of the frame.
+	Samples int
+
+	// VBRHeader is whether the frame has a Xing, Info or VBRI header
+	// in place of audio.
+	VBRHeader bool
+
+	// Offset is the byte offset of the frame in the source.
+	Offset int64
+
+	// Data is the frame including the header.
+	Data []byte
+}
+
+// FrameReader reads raw frames of a stream without decoding them.
+// Tags in the stream are skipped.
+type FrameReader struct {
+	source *source
+	frames int
+	// prev is the header of the previous frame
+	prev frameheader.FrameHeader
+}
+
+// NewFrameReader returns a FrameReader that reads frames from r.
+// When r is io.Seeker, the tags at the end are not read as frames.
+func NewFrameReader(r io.Reader) (*FrameReader, error) {
+	s := &source{
+		reader: r,
+	}
+
+	if err := s.readTrailingTags(); err != nil {
+		return nil, err
+	}
+
+	if err := s.skipTags(); err != nil {
+		return nil, err
+	}
+
+	return &FrameReader{source: s}, nil
+}
+
+// ReadFrame reads the next frame.
+// ReadFrame returns io.EOF at the end of the stream,
+// and io.ErrUnexpectedEOF when the last frame is truncated.
+func (r *FrameReader) ReadFrame() (*Frame, error) {
+	h, pos, err := frameheader.Read(r.source, r.source.pos, r.prev)
+	if err != nil {
+		if _, ok := err.(*consts.UnexpectedEOF); ok {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	size, err := r.source.frameSize(h)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	binary.BigEndian.PutUint32(data, uint32(h))
+	if n, err := r.source.ReadFull(data[4:]); n < size-4 {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	freq, err := h.SamplingFrequencyValue()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Frame{
+		Version:       Version(h.VersionIndex()),
+		Layer:         4 - int(h.Layer()),
+		Bitrate:       h.Bitrate(),
+		SampleRate:    freq,
+		Mode:          Mode(h.Mode()),
+		ModeExtension: h.ModeExtension(),
+		Padding:       h.PaddingBit() == 1,
+		CRC:           h.ProtectionBit() == 0,
+		CRCValid:      frame.CheckCRC(h, data),
+		Copyright:     h.Copyright() == 1,
+		Original:      h.OriginalOrCopy() == 1,
+		Emphasis:      h.Emphasis(),
+		Samples:       h.SamplesPerFrame(),
+		Offset:        pos,
+		Data:          data,
+	}
+
+	if h.IsFreeFormat() {
+		f.Bitrate = size * 8 * freq / f.Samples
+	}
+
+	// only the first frame can have a VBR header
+	if r.frames == 0 {
+		f.VBRHeader = parseXing(h, data[4:]) != nil || parseVBRI(h, data[4:]) != nil
+	}
+	r.frames++
+	r.prev = h
+
+	return f, nil
+}
@@ -0,0 +1,179 @@
+package id3
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Chapter is the content of a CHAP frame.
+type Chapter struct {
+	// ID is the element ID, which is referred to by tables of contents.
+	ID string
+
+	// Start and End are the times of the start and the end of the chapter.
+	Start time.Duration
+	End   time.Duration
+
+	// StartOffset and EndOffset are the byte offsets in the file of the first
+	// audio frame of the chapter and the one after the last,
+	// or -1 when they are not available.
+	StartOffset int64
+	EndOffset   int64
+
+	// Frames is the frames embedded in the chapter like TIT2.
+	Frames []*Frame
+}
+
+// TableOfContents is the content of a CTOC frame.
+type TableOfContents struct {
+	// ID is the element ID.
+	ID string
+
+	// TopLevel is whether this is the root of the tables of contents.
+	TopLevel bool
+
+	// Ordered is whether the children are in order.
+	Ordered bool
+
+	// Children is the element IDs of the chapters
+	// and the tables of contents in this one.
+	Children []string
+
+	// Frames is the frames embedded in the table of contents like TIT2.
+	Frames []*Frame
+}
+
+// Chapters returns the chapters in the order they appear.
+// Chapters that can't be read are left out.
+func (t *Tag) Chapters() []*Chapter {
+	var cs []*Chapter
+	for _, f := range t.FramesByID("CHAP") {
+		c, err := t.chapter(f)
+		if err != nil {
+			continue
+		}
+		cs = append(cs, c)
+	}
+
+	return cs
+}
+
+// Chapter returns the chapter with the element ID, or nil when there is none.
+func (t *Tag) Chapter(id string) *Chapter {
+	for _, c := range t.Chapters() {
+		if c.ID == id {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// TablesOfContents returns the tables of contents in the order they appear.
+// Tables of contents that can't be read are left out.
+func (t *Tag) TablesOfContents() []*TableOfContents {
+	var ts []*TableOfContents
+	for _, f := range t.FramesByID("CTOC") {
+		toc, err := t.tableOfContents(f)
+		if err != nil {
+			continue
+		}
+		ts = append(ts, toc)
+	}
+
+	return ts
+}
+
+// chapter returns the content of a CHAP frame.
+func (t *Tag) chapter(f *Frame) (*Chapter, error) {
+	id, b := cutText(EncodingISO88591, f.Data)
+	if len(b) < 16 {
+		return nil, errors.New("id3: chapter frame is truncated")
+	}
+
+	c := &Chapter{
+		ID:          string(id),
+		Start:       time.Duration(binary.BigEndian.Uint32(b[0:4])) * time.Millisecond,
+		End:         time.Duration(binary.BigEndian.Uint32(b[4:8])) * time.Millisecond,
+		StartOffset: chapterOffset(b[8:12]),
+		EndOffset:   chapterOffset(b[12:16]),
+	}
+
+	var err error
+	if c.Frames, err = t.readFrames(b[16:]); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// tableOfContents returns the content of a CTOC frame.
+func (t *Tag) tableOfContents(f *Frame) (*TableOfContents, error) {
+	id, b := cutText(EncodingISO88591, f.Data)
+	if len(b) < 2 {
+		return nil, errors.New("id3: table of contents frame is truncated")
+	}
+
+	toc := &TableOfContents{
+		ID:       string(id),
+		TopLevel: b[0]&0x2 != 0,
+		Ordered:  b[0]&0x1 != 0,
+	}
+
+	n := int(b[1])
+	b = b[2:]
+	for i := 0; i < n; i++ {
+		if len(b) == 0 {
+			return nil, errors.New("id3: table of contents frame is truncated")
+		}
+
+		var child []byte
+		child, b = cutText(EncodingISO88591, b)
+		toc.Children = append(toc.Children, string(child))
+	}
+
+	var err error
+	if toc.Frames, err = t.readFrames(b); err != nil {
+		return nil, err
+	}
+
+	return toc, nil
+}
+
+// chapterOffset returns the byte offset of a chapter,
+// where 0xffffffff means it is not available.
+func chapterOffset(b []byte) int64 {
+	v := binary.BigEndian.Uint32(b)
+	if v == 0xffffffff {
+		return -1
+	}
+
+	return int64(v)
+}
+
+// Title returns the title of the chapter.
+func (c *Chapter) Title() string {
+	return frameText(c.Frames, "TIT2")
+}
+
+// Title returns the title of the table of contents.
+func (toc *TableOfContents) Title() string {
+	return frameText(toc.Frames, "TIT2")
+}
+
+// frameText returns the first value of the text frame with the given ID
+// in fs, or an empty string when there is none.
+func frameText(fs []*Frame, id string) string {
+	for _, f := range fs {
+		if f.ID != id {
+			continue
+		}
+
+		if values, err := f.Text(); err == nil && len(values) > 0 {
+			return values[0]
+		}
+	}
+
+	return ""
+}
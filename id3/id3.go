@@ -0,0 +1,504 @@
+// Package id3 reads ID3v2 tags of the versions 2.2, 2.3 and 2.4
+// and ID3v1 tags, and writes ID3v2 tags of the versions 2.3 and 2.4.
+// A tag is edited with SetText, SetComment, AddPicture and RemoveFrames,
+// and written with Tag.Marshal or to the start of a file with WriteFile.
+package id3
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HeaderSize is the size of the header and of the footer of a tag.
+const HeaderSize = 10
+
+// Flags of the tag header.
+const (
+	FlagUnsynchronisation = 0x80
+	FlagExtendedHeader    = 0x40
+	FlagExperimental      = 0x20
+	FlagFooter            = 0x10
+)
+
+// Tag is an ID3v2 tag.
+type Tag struct {
+	// Version is the major version, 2, 3 or 4.
+	Version int
+
+	// Revision is the revision of the version.
+	Revision int
+
+	// Flags is the flags of the tag header.
+	Flags byte
+
+	// Frames is the frames of the tag in the order they appear.
+	// Encrypted frames are left out as they can't be read.
+	Frames []*Frame
+}
+
+// Frame is a frame of a tag.
+type Frame struct {
+	// ID is the frame ID as it is in the tag,
+	// which has 3 characters in version 2.2 and 4 characters otherwise.
+	ID string
+
+	// Data is the content of the frame, after unsynchronisation is removed
+	// and it is decompressed.
+	Data []byte
+}
+
+// v22IDs maps the frame IDs of version 2.3 to the ones of version 2.2.
+var v22IDs = map[string]string{
+	"APIC": "PIC",
+	"COMM": "COM",
+	"TALB": "TAL",
+	"TBPM": "TBP",
+	"TCOM": "TCM",
+	"TCON": "TCO",
+	"TCOP": "TCR",
+	"TDAT": "TDA",
+	"TENC": "TEN",
+	"TEXT": "TXT",
+	"TIME": "TIM",
+	"TIT1": "TT1",
+	"TIT2": "TT2",
+	"TIT3": "TT3",
+	"TKEY": "TKE",
+	"TLAN": "TLA",
+	"TLEN": "TLE",
+	"TMED": "TMT",
+	"TOAL": "TOT",
+	"TOFN": "TOF",
+	"TOLY": "TOL",
+	"TOPE": "TOA",
+	"TORY": "TOR",
+	"TPE1": "TP1",
+	"TPE2": "TP2",
+	"TPE3": "TP3",
+	"TPE4": "TP4",
+	"TPOS": "TPA",
+	"TPUB": "TPB",
+	"TRCK": "TRK",
+	"TRDA": "TRD",
+	"TSIZ": "TSI",
+	"TSRC": "TRC",
+	"TSSE": "TSS",
+	"TXXX": "TXX",
+	"TYER": "TYE",
+	"UFID": "UFI",
+	"USLT": "ULT",
+	"WXXX": "WXX",
+}
+
+// TagSize returns the size of the tag with the given header,
+// including the header and the footer if there is one.
+func TagSize(header []byte) (int, error) {
+	if len(header) < HeaderSize || string(header[:3]) != "ID3" {
+		return 0, errors.New("id3: invalid header")
+	}
+
+	if header[3] == 0xff || header[4] == 0xff {
+		return 0, errors.New("id3: invalid version")
+	}
+
+	size, ok := syncsafe(header[6:10])
+	if !ok {
+		return 0, errors.New("id3: invalid size")
+	}
+
+	size += HeaderSize
+	if header[3] >= 4 && header[5]&FlagFooter != 0 {
+		size += HeaderSize
+	}
+
+	return size, nil
+}
+
+// Read reads a tag from r, which must be at the start of the tag header.
+// Read reads exactly the bytes of the tag from r.
+func Read(r io.Reader) (*Tag, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size, err := TagSize(header)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, size)
+	copy(b, header)
+	if _, err := io.ReadFull(r, b[HeaderSize:]); err != nil {
+		return nil, err
+	}
+
+	return Parse(b)
+}
+
+// Parse parses the tag at the start of b.
+func Parse(b []byte) (*Tag, error) {
+	size, err := TagSize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < size {
+		return nil, errors.New("id3: tag is truncated")
+	}
+
+	t := &Tag{
+		Version:  int(b[3]),
+		Revision: int(b[4]),
+		Flags:    b[5],
+	}
+	if t.Version < 2 || t.Version > 4 {
+		return nil, fmt.Errorf("id3: version 2.%d is not supported", t.Version)
+	}
+
+	n, _ := syncsafe(b[6:10])
+	data := b[HeaderSize : HeaderSize+n]
+	// unsynchronisation is done for each frame in version 2.4
+	if t.Version < 4 && t.Flags&FlagUnsynchronisation != 0 {
+		data = removeUnsynchronisation(data)
+	}
+
+	if t.Flags&FlagExtendedHeader != 0 {
+		if t.Version == 2 {
+			// the flag means compression in version 2.2
+			return nil, errors.New("id3: compressed tags are not supported")
+		}
+
+		if data, err = skipExtendedHeader(t.Version, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.Frames, err = t.readFrames(data); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// readFrames reads the frames in data, which may be followed by padding.
+func (t *Tag) readFrames(data []byte) ([]*Frame, error) {
+	var fs []*Frame
+	for len(data) > 0 {
+		f, rest, err := t.readFrame(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if f == nil && rest == nil {
+			// the rest is padding
+			break
+		}
+
+		if f != nil {
+			fs = append(fs, f)
+		}
+		data = rest
+	}
+
+	return fs, nil
+}
+
+// skipExtendedHeader returns data without the extended header at its start.
+func skipExtendedHeader(version int, data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("id3: extended header is truncated")
+	}
+
+	// the size doesn't include itself in version 2.3
+	n := int(binary.BigEndian.Uint32(data)) + 4
+	if version == 4 {
+		size, ok := syncsafe(data)
+		if !ok {
+			return nil, errors.New("id3: invalid extended header size")
+		}
+		n = size
+	}
+
+	if n < 4 || n > len(data) {
+		return nil, errors.New("id3: extended header is truncated")
+	}
+
+	return data[n:], nil
+}
+
+// readFrame reads a frame at the start of data and returns the rest.
+// readFrame returns nil frame for a frame that can't be read like an
+// encrypted one, and nil frame and rest for padding.
+func (t *Tag) readFrame(data []byte) (*Frame, []byte, error) {
+	idSize, headerSize := 4, 10
+	if t.Version == 2 {
+		idSize, headerSize = 3, 6
+	}
+
+	if len(data) < headerSize || !validID(data[:idSize]) {
+		// what follows is padding, or a broken frame treated as padding
+		return nil, nil, nil
+	}
+
+	id := string(data[:idSize])
+	var size int
+	var flags uint16
+	switch t.Version {
+	case 2:
+		size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+	case 3:
+		size = int(binary.BigEndian.Uint32(data[4:8]))
+		flags = binary.BigEndian.Uint16(data[8:10])
+	case 4:
+		s, ok := syncsafe(data[4:8])
+		if !ok {
+			return nil, nil, fmt.Errorf("id3: invalid size of frame %s", id)
+		}
+		size = s
+		flags = binary.BigEndian.Uint16(data[8:10])
+	}
+
+	data = data[headerSize:]
+	if size > len(data) {
+		return nil, nil, fmt.Errorf("id3: frame %s is truncated", id)
+	}
+
+	rest := data[size:]
+	content, err := t.frameContent(flags, data[:size])
+	if err != nil {
+		return nil, nil, fmt.Errorf("id3: frame %s: %w", id, err)
+	}
+
+	if content == nil {
+		return nil, rest, nil
+	}
+
+	return &Frame{ID: id, Data: content}, rest, nil
+}
+
+// frameContent returns the content of a frame with the flags from b.
+// frameContent returns nil when the frame is encrypted.
+func (t *Tag) frameContent(flags uint16, b []byte) ([]byte, error) {
+	var compressed, encrypted, unsynchronised bool
+	switch t.Version {
+	case 3:
+		compressed = flags&0x0080 != 0
+		encrypted = flags&0x0040 != 0
+		// the decompressed size, the encryption method and the group ID
+		// are before the content
+		skip := 0
+		if compressed {
+			skip += 4
+		}
+		if encrypted {
+			skip++
+		}
+		if flags&0x0020 != 0 {
+			skip++
+		}
+		if skip > len(b) {
+			return nil, errors.New("frame is truncated")
+		}
+		b = b[skip:]
+	case 4:
+		compressed = flags&0x0008 != 0
+		encrypted = flags&0x0004 != 0
+		unsynchronised = flags&0x0002 != 0 || t.Flags&FlagUnsynchronisation != 0
+		// the group ID, the encryption method and the data length indicator
+		// are before the content
+		skip := 0
+		if flags&0x0040 != 0 {
+			skip++
+		}
+		if encrypted {
+			skip++
+		}
+		if flags&0x0001 != 0 {
+			skip += 4
+		}
+		if skip > len(b) {
+			return nil, errors.New("frame is truncated")
+		}
+		b = b[skip:]
+	}
+
+	if encrypted {
+		return nil, nil
+	}
+
+	if unsynchronised {
+		b = removeUnsynchronisation(b)
+	}
+
+	if compressed {
+		r, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		if b, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Frame returns the first frame with the given ID, or nil when there is none.
+// The ID is of version 2.3 and 2.4, which is translated for version 2.2 tags.
+func (t *Tag) Frame(id string) *Frame {
+	if fs := t.FramesByID(id); len(fs) > 0 {
+		return fs[0]
+	}
+
+	return nil
+}
+
+// FramesByID returns the frames with the given ID.
+// The ID is of version 2.3 and 2.4, which is translated for version 2.2 tags.
+func (t *Tag) FramesByID(id string) []*Frame {
+	if t.Version == 2 {
+		id = v22IDs[id]
+	}
+
+	var fs []*Frame
+	for _, f := range t.Frames {
+		if f.ID == id {
+			fs = append(fs, f)
+		}
+	}
+
+	return fs
+}
+
+// Text returns the first value of the text frame with the given ID,
+// or an empty string when there is none.
+func (t *Tag) Text(id string) string {
+	f := t.Frame(id)
+	if f == nil {
+		return ""
+	}
+
+	values, err := f.Text()
+	if err != nil || len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// Title returns the title.
+func (t *Tag) Title() string {
+	return t.Text("TIT2")
+}
+
+// Artist returns the lead artist.
+func (t *Tag) Artist() string {
+	return t.Text("TPE1")
+}
+
+// Album returns the album title.
+func (t *Tag) Album() string {
+	return t.Text("TALB")
+}
+
+// Track returns the track number and the total number of tracks,
+// either of which is 0 when it is not available.
+func (t *Tag) Track() (track, total int) {
+	return parseNumberAndTotal(t.Text("TRCK"))
+}
+
+// Year returns the recording year, or 0 when it is not available.
+func (t *Tag) Year() int {
+	// version 2.4 has the recording time in place of the year
+	s := t.Text("TDRC")
+	if s == "" {
+		s = t.Text("TYER")
+	}
+
+	if len(s) < 4 {
+		return 0
+	}
+
+	y, err := strconv.Atoi(s[:4])
+	if err != nil {
+		return 0
+	}
+
+	return y
+}
+
+// Genre returns the genre, where a reference to an ID3v1 genre
+// like "(17)" or "17" is resolved to its name.
+func (t *Tag) Genre() string {
+	return resolveGenre(t.Text("TCON"))
+}
+
+// Comments returns the comments.
+// Comments that can't be read are left out.
+func (t *Tag) Comments() []Comment {
+	var cs []Comment
+	for _, f := range t.FramesByID("COMM") {
+		c, err := f.Comment()
+		if err != nil {
+			continue
+		}
+		cs = append(cs, c)
+	}
+
+	return cs
+}
+
+// parseNumberAndTotal parses a position like "3/12".
+func parseNumberAndTotal(s string) (n, total int) {
+	a, b, _ := strings.Cut(s, "/")
+	n, _ = strconv.Atoi(strings.TrimSpace(a))
+	total, _ = strconv.Atoi(strings.TrimSpace(b))
+	return n, total
+}
+
+// validID returns whether id consists of upper-case letters and digits.
+func validID(id []byte) bool {
+	for _, c := range id {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// syncsafe returns the value of a 4-byte syncsafe integer,
+// whose bytes have the most significant bit unset.
+func syncsafe(b []byte) (int, bool) {
+	var n int
+	for _, c := range b[:4] {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		n = n<<7 | int(c)
+	}
+
+	return n, true
+}
+
+// removeUnsynchronisation removes the zero bytes inserted after 0xff.
+func removeUnsynchronisation(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,465 @@
+package id3_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/pchchv/mp3/id3"
+)
+
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// tag returns a tag of the version with the frames that are already encoded.
+func tag(version int, flags byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	if version < 4 && flags&FlagUnsynchronisation != 0 {
+		body = bytes.ReplaceAll(body, []byte{0xff}, []byte{0xff, 0})
+	}
+	// padding
+	body = append(body, make([]byte, 16)...)
+	b := append([]byte{'I', 'D', '3', byte(version), 0, flags}, syncsafe(len(body))...)
+	b = append(b, body...)
+	if flags&FlagFooter != 0 {
+		b = append(b, '3', 'D', 'I', byte(version), 0, flags)
+		b = append(b, syncsafe(len(body))...)
+	}
+	return b
+}
+
+// frame returns a frame of the version.
+func frame(version int, id string, flags uint16, data []byte) []byte {
+	b := []byte(id)
+	switch version {
+	case 2:
+		b = append(b, byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	case 3:
+		b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+		b = binary.BigEndian.AppendUint16(b, flags)
+	case 4:
+		b = append(b, syncsafe(len(data))...)
+		b = binary.BigEndian.AppendUint16(b, flags)
+	}
+	return append(b, data...)
+}
+
+func TestVersion22(t *testing.T) {
+	b := tag(2, 0,
+		frame(2, "TT2", 0, []byte("\x00Title")),
+		frame(2, "TP1", 0, []byte("\x00Artist\x00")),
+		frame(2, "TRK", 0, []byte("\x003/12")),
+		frame(2, "TYE", 0, []byte("\x001999")),
+		frame(2, "TCO", 0, []byte("\x00(17)")),
+		frame(2, "COM", 0, []byte("\x00engdesc\x00text")),
+	)
+	tg, err := Read(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tg.Version != 2 || len(tg.Frames) != 6 {
+		t.Fatalf("got version %d with %d frames", tg.Version, len(tg.Frames))
+	}
+
+	if got := tg.Title(); got != "Title" {
+		t.Errorf("Title(): got %q", got)
+	}
+
+	if got := tg.Artist(); got != "Artist" {
+		t.Errorf("Artist(): got %q", got)
+	}
+
+	if track, total := tg.Track(); track != 3 || total != 12 {
+		t.Errorf("Track(): got %d, %d", track, total)
+	}
+
+	if got := tg.Year(); got != 1999 {
+		t.Errorf("Year(): got %d", got)
+	}
+
+	if got := tg.Genre(); got != "Rock" {
+		t.Errorf("Genre(): got %q", got)
+	}
+
+	want := []Comment{{Language: "eng", Description: "desc", Text: "text"}}
+	if got := tg.Comments(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Comments(): got %+v, want %+v", got, want)
+	}
+}
+
+func TestVersion23(t *testing.T) {
+	// UTF-16 little endian with the byte order mark
+	title := []byte{1, 0xff, 0xfe, 'T', 0, 0xe9, 0, 0x3d, 0xd8, 0x00, 0xde}
+
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	w.Write([]byte("\x00Compressed"))
+	w.Close()
+	album := binary.BigEndian.AppendUint32(nil, 11)
+	album = append(album, z.Bytes()...)
+
+	b := tag(3, FlagUnsynchronisation|FlagExtendedHeader,
+		// the extended header without CRC
+		[]byte{0, 0, 0, 6, 0, 0, 0, 0, 0, 0},
+		frame(3, "TIT2", 0, title),
+		// a byte that needs unsynchronisation
+		frame(3, "TPE1", 0, []byte("\x00\xffArtist")),
+		frame(3, "TALB", 0x0080, album),
+		frame(3, "TCON", 0, []byte("\x00(4)Eurodisco")),
+		frame(3, "TXXX", 0x0040, []byte("\x01encrypted")),
+	)
+	tg, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tg.Title(); got != "Té😀" {
+		t.Errorf("Title(): got %q", got)
+	}
+
+	if got := tg.Artist(); got != "ÿArtist" {
+		t.Errorf("Artist(): got %q", got)
+	}
+
+	if got := tg.Album(); got != "Compressed" {
+		t.Errorf("Album(): got %q", got)
+	}
+
+	if got := tg.Genre(); got != "Eurodisco" {
+		t.Errorf("Genre(): got %q", got)
+	}
+
+	// the encrypted frame is left out
+	if got := len(tg.Frames); got != 4 {
+		t.Errorf("len(Frames): got %d, want %d", got, 4)
+	}
+}
+
+func TestVersion24(t *testing.T) {
+	artists := append([]byte{2}, "\x00A\x00\x00\x00B"...)
+	// unsynchronisation with the data length indicator
+	title := append(syncsafe(4), "\x00\xff\x00T\xff\x00"...)
+
+	b := tag(4, FlagExtendedHeader|FlagFooter,
+		// the extended header including its size
+		[]byte{0, 0, 0, 6, 1, 0},
+		frame(4, "TPE1", 0, artists),
+		frame(4, "TIT2", 0x0003, title),
+		frame(4, "TDRC", 0, []byte("\x032004-05-01")),
+		frame(4, "TCON", 0, []byte("\x0313\x00")),
+	)
+	size, err := TagSize(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != len(b) {
+		t.Errorf("TagSize(): got %d, want %d", size, len(b))
+	}
+
+	// the rest after the tag is not read
+	r := bytes.NewReader(append(b, 0xff, 0xfb))
+	tg, err := Read(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Len() != 2 {
+		t.Errorf("unread bytes: got %d, want %d", r.Len(), 2)
+	}
+
+	values, err := tg.Frame("TPE1").Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"A", "B"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("TPE1: got %q, want %q", values, want)
+	}
+
+	if got := tg.Title(); got != "ÿTÿ" {
+		t.Errorf("Title(): got %q", got)
+	}
+
+	if got := tg.Year(); got != 2004 {
+		t.Errorf("Year(): got %d", got)
+	}
+
+	if got := tg.Genre(); got != "Pop" {
+		t.Errorf("Genre(): got %q", got)
+	}
+}
+
+func TestV1(t *testing.T) {
+	b := make([]byte, V1ExtendedSize+V1Size)
+	ext, v1 := b[:V1ExtendedSize], b[V1ExtendedSize:]
+	copy(v1, "TAG")
+	copy(v1[3:], "A title of thirty characters..")
+	copy(v1[33:], "Artist")
+	copy(v1[93:], "1987")
+	copy(v1[97:], "Comment")
+	v1[126] = 7
+	v1[127] = 17
+	copy(ext, "TAG+")
+	copy(ext[4:], " continued")
+	ext[184] = 2
+	copy(ext[185:], "Krautrock")
+	copy(ext[215:], "000:30")
+
+	tg, err := ParseV1(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &V1Tag{
+		Title:         "A title of thirty characters.. continued",
+		Artist:        "Artist",
+		Year:          1987,
+		Comment:       "Comment",
+		Track:         7,
+		Genre:         17,
+		Speed:         2,
+		ExtendedGenre: "Krautrock",
+		StartTime:     "000:30",
+	}
+	if !reflect.DeepEqual(tg, want) {
+		t.Errorf("ParseV1(): got %+v, want %+v", tg, want)
+	}
+
+	if got := tg.GenreName(); got != "Krautrock" {
+		t.Errorf("GenreName(): got %q", got)
+	}
+
+	tg, err = ParseV1(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tg.Title != "A title of thirty characters.." || tg.GenreName() != "Rock" {
+		t.Errorf("ParseV1() without the extended block: got %+v", tg)
+	}
+}
+
+func TestPictures(t *testing.T) {
+	image := []byte("\x89PNG\r\n\x1a\n\x00\x00")
+	apic := append([]byte("\x01image/png\x00\x03\xff\xfeC\x00\x00\x00"), image...)
+	pic := append([]byte("\x00JPG\x04Back\x00"), image...)
+
+	for _, c := range []struct {
+		version int
+		frame   []byte
+		want    Picture
+	}{
+		{3, frame(3, "APIC", 0, apic), Picture{MIMEType: "image/png", Type: PictureFrontCover, Description: "C", Data: image}},
+		{2, frame(2, "PIC", 0, pic), Picture{MIMEType: "image/jpeg", Type: PictureBackCover, Description: "Back", Data: image}},
+	} {
+		tg, err := Parse(tag(c.version, 0, c.frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ps := tg.Pictures()
+		if len(ps) != 1 {
+			t.Fatalf("Pictures() of version 2.%d: got %d pictures", c.version, len(ps))
+		}
+
+		if !reflect.DeepEqual(*ps[0], c.want) {
+			t.Errorf("Pictures() of version 2.%d: got %+v, want %+v", c.version, *ps[0], c.want)
+		}
+	}
+}
+
+func TestChapters(t *testing.T) {
+	title := frame(4, "TIT2", 0, []byte("\x03Intro"))
+	chap := append([]byte("ch0\x00"), 0, 0, 0, 0, 0, 0, 0x03, 0xe8, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	chap = append(chap, title...)
+	ctoc := append([]byte("toc\x00\x03\x02ch0\x00ch1\x00"), title...)
+
+	tg, err := Parse(tag(4, 0, frame(4, "CTOC", 0, ctoc), frame(4, "CHAP", 0, chap)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := tg.Chapters()
+	if len(cs) != 1 {
+		t.Fatalf("Chapters(): got %d chapters", len(cs))
+	}
+
+	c := cs[0]
+	if c.ID != "ch0" || c.Start != 0 || c.End != time.Second || c.StartOffset != -1 || c.EndOffset != -1 || c.Title() != "Intro" {
+		t.Errorf("Chapters()[0]: got %+v", c)
+	}
+
+	if tg.Chapter("ch0") == nil || tg.Chapter("ch1") != nil {
+		t.Errorf("Chapter(%q): got a chapter", "ch1")
+	}
+
+	ts := tg.TablesOfContents()
+	if len(ts) != 1 {
+		t.Fatalf("TablesOfContents(): got %d tables", len(ts))
+	}
+
+	toc := ts[0]
+	if toc.ID != "toc" || !toc.TopLevel || !toc.Ordered || !reflect.DeepEqual(toc.Children, []string{"ch0", "ch1"}) || toc.Title() != "Intro" {
+		t.Errorf("TablesOfContents()[0]: got %+v", toc)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	for _, version := range []int{3, 4} {
+		tg := NewTag(version)
+		tg.SetText("TIT2", "Title")
+		tg.SetText("TPE1", "A", "Б")
+		tg.SetComment(Comment{Language: "eng", Text: "first"})
+		tg.SetComment(Comment{Language: "eng", Text: "second"})
+		tg.AddPicture(&Picture{MIMEType: "image/png", Type: PictureFrontCover, Data: []byte{1, 2, 3}})
+
+		b, err := tg.Marshal(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := Parse(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Version != version || got.Title() != "Title" {
+			t.Errorf("version 2.%d: got %+v", version, got)
+		}
+
+		want := []string{"A", "Б"}
+		if version == 3 {
+			want = []string{"A/Б"}
+		}
+
+		if values, _ := got.Frame("TPE1").Text(); !reflect.DeepEqual(values, want) {
+			t.Errorf("TPE1 of version 2.%d: got %q, want %q", version, values, want)
+		}
+
+		if cs := got.Comments(); len(cs) != 1 || cs[0].Text != "second" {
+			t.Errorf("Comments() of version 2.%d: got %+v", version, cs)
+		}
+
+		if ps := got.Pictures(); len(ps) != 1 || !bytes.Equal(ps[0].Data, []byte{1, 2, 3}) {
+			t.Errorf("Pictures() of version 2.%d: got %+v", version, ps)
+		}
+	}
+}
+
+func TestMarshalVersion23(t *testing.T) {
+	// a tag read as version 2.4 with UTF-8 texts is written as version 2.3
+	tg := NewTag(4)
+	tg.SetText("TPE1", "A", "Б")
+	tg.SetComment(Comment{Language: "eng", Description: "д", Text: "comment"})
+	tg.Frames = append(tg.Frames,
+		&Frame{ID: "TXXX", Data: []byte("\x03desc\x00знач")},
+		&Frame{ID: "TIT2", Data: []byte("\x02\x04\x11")},
+		&Frame{ID: "PRIV", Data: []byte("\x03owner\x00")},
+	)
+	tg.Version = 3
+
+	b, err := tg.Marshal(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range got.Frames {
+		if f.ID != "PRIV" && f.Data[0] != EncodingUTF16 {
+			t.Errorf("%s: got encoding %d, want %d", f.ID, f.Data[0], EncodingUTF16)
+		}
+	}
+
+	if values, _ := got.Frame("TPE1").Text(); !reflect.DeepEqual(values, []string{"A/Б"}) {
+		t.Errorf("TPE1: got %q", values)
+	}
+
+	if values, _ := got.Frame("TXXX").Text(); !reflect.DeepEqual(values, []string{"desc", "знач"}) {
+		t.Errorf("TXXX: got %q", values)
+	}
+
+	if got.Title() != "Б" {
+		t.Errorf("Title(): got %q", got.Title())
+	}
+
+	if cs := got.Comments(); len(cs) != 1 || cs[0] != (Comment{Language: "eng", Description: "д", Text: "comment"}) {
+		t.Errorf("Comments(): got %+v", cs)
+	}
+
+	// frames without a text encoding are written as they are
+	if f := got.Frame("PRIV"); !bytes.Equal(f.Data, []byte("\x03owner\x00")) {
+		t.Errorf("PRIV: got %q", f.Data)
+	}
+
+	tg.AddPicture(&Picture{MIMEType: "image/png", Description: "д", Data: []byte{1}})
+	tg.Frames[len(tg.Frames)-1].Data[0] = EncodingUTF8
+	if _, err := tg.Marshal(0); err == nil {
+		t.Errorf("Marshal() with a UTF-8 picture description: got no error")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.mp3")
+	audio := []byte("\xff\xfb\x90\xc0 audio")
+
+	tg := NewTag(4)
+	tg.SetText("TIT2", "Title")
+	b, err := tg.Marshal(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(name, append(b, audio...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		title   string
+		inPlace bool
+	}{
+		{"A longer title", true},
+		{strings.Repeat("A title longer than the padding", 4), false},
+	} {
+		tg.SetText("TIT2", c.title)
+		if err := WriteFile(name, tg); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inPlace := len(got) == len(b)+len(audio); inPlace != c.inPlace {
+			t.Errorf("WriteFile() with %q: got in place %t, want %t", c.title, inPlace, c.inPlace)
+		}
+
+		r := bytes.NewReader(got)
+		parsed, err := Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.Title() != c.title {
+			t.Errorf("WriteFile() with %q: got title %q", c.title, parsed.Title())
+		}
+
+		// the audio is kept as it is
+		if rest := got[len(got)-r.Len():]; !bytes.Equal(rest, audio) {
+			t.Errorf("WriteFile() with %q: got audio %q, want %q", c.title, rest, audio)
+		}
+	}
+}
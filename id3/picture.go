@@ -0,0 +1,116 @@
+package id3
+
+import (
+	"errors"
+	"strings"
+)
+
+// Types of pictures.
+const (
+	PictureOther             = 0x00
+	PictureFileIcon          = 0x01 // 32x32 pixels PNG
+	PictureOtherFileIcon     = 0x02
+	PictureFrontCover        = 0x03
+	PictureBackCover         = 0x04
+	PictureLeaflet           = 0x05
+	PictureMedia             = 0x06
+	PictureLeadArtist        = 0x07
+	PictureArtist            = 0x08
+	PictureConductor         = 0x09
+	PictureBand              = 0x0a
+	PictureComposer          = 0x0b
+	PictureLyricist          = 0x0c
+	PictureRecordingLocation = 0x0d
+	PictureDuringRecording   = 0x0e
+	PictureDuringPerformance = 0x0f
+	PictureScreenCapture     = 0x10
+	PictureBrightFish        = 0x11
+	PictureIllustration      = 0x12
+	PictureBandLogo          = 0x13
+	PicturePublisherLogo     = 0x14
+)
+
+// Picture is the content of an APIC frame, or a PIC frame of version 2.2.
+type Picture struct {
+	// MIMEType is the MIME type of the image like "image/jpeg",
+	// or "-->" when Data is a URL of the image.
+	MIMEType string
+
+	// Type is the type of the picture like PictureFrontCover.
+	Type int
+
+	// Description is the description of the picture.
+	Description string
+
+	// Data is the image, which shares the memory with the frame.
+	Data []byte
+}
+
+// Picture returns the content of an APIC or PIC frame.
+func (f *Frame) Picture() (*Picture, error) {
+	if len(f.Data) < 1 {
+		return nil, errors.New("id3: picture frame is empty")
+	}
+
+	enc := f.Data[0]
+	b := f.Data[1:]
+	var mime string
+	if f.ID == "PIC" {
+		// version 2.2 has the image format in 3 characters
+		if len(b) < 3 {
+			return nil, errors.New("id3: picture frame is truncated")
+		}
+		mime = imageFormatMIMEType(string(b[:3]))
+		b = b[3:]
+	} else {
+		var m []byte
+		m, b = cutText(EncodingISO88591, b)
+		mime = string(m)
+	}
+
+	if len(b) < 1 {
+		return nil, errors.New("id3: picture frame is truncated")
+	}
+
+	p := &Picture{
+		MIMEType: mime,
+		Type:     int(b[0]),
+	}
+
+	desc, data := cutText(enc, b[1:])
+	d, err := decodeText(enc, desc)
+	if err != nil {
+		return nil, err
+	}
+	p.Description = d
+	p.Data = data
+	return p, nil
+}
+
+// Pictures returns the pictures.
+// Pictures that can't be read are left out.
+func (t *Tag) Pictures() []*Picture {
+	var ps []*Picture
+	for _, f := range t.FramesByID("APIC") {
+		p, err := f.Picture()
+		if err != nil {
+			continue
+		}
+		ps = append(ps, p)
+	}
+
+	return ps
+}
+
+// imageFormatMIMEType returns the MIME type of an image format
+// of version 2.2 like "JPG".
+func imageFormatMIMEType(format string) string {
+	switch strings.ToUpper(format) {
+	case "JPG":
+		return "image/jpeg"
+	case "-->":
+		return format
+	}
+
+	return "image/" + strings.ToLower(format)
+}
@@ -0,0 +1,152 @@
+package id3
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Text encodings of frames.
+const (
+	EncodingISO88591 = 0
+	EncodingUTF16    = 1 // with a byte order mark
+	EncodingUTF16BE  = 2
+	EncodingUTF8     = 3
+)
+
+// Comment is the content of a COMM frame.
+type Comment struct {
+	// Language is the ISO 639-2 code of the language like "eng".
+	Language string
+
+	// Description is the short description of the comment.
+	Description string
+
+	// Text is the comment.
+	Text string
+}
+
+// Text returns the values of a text frame, whose ID starts with 'T'
+// except TXXX. Version 2.4 allows a frame to have several values.
+func (f *Frame) Text() ([]string, error) {
+	if len(f.Data) < 1 {
+		return nil, errors.New("id3: text frame is empty")
+	}
+
+	enc := f.Data[0]
+	var values []string
+	for b := f.Data[1:]; len(b) > 0; {
+		var v []byte
+		v, b = cutText(enc, b)
+		s, err := decodeText(enc, v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, s)
+	}
+
+	// the values may be followed by a terminator
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+
+	return values, nil
+}
+
+// Comment returns the content of a COMM frame.
+func (f *Frame) Comment() (Comment, error) {
+	if len(f.Data) < 4 {
+		return Comment{}, errors.New("id3: comment frame is truncated")
+	}
+
+	enc := f.Data[0]
+	desc, text := cutText(enc, f.Data[4:])
+	d, err := decodeText(enc, desc)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	s, err := decodeText(enc, text)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	return Comment{
+		Language:    string(f.Data[1:4]),
+		Description: d,
+		Text:        strings.TrimRight(s, "\x00"),
+	}, nil
+}
+
+// cutText returns the text in b up to the terminator of the encoding
+// and what follows the terminator.
+func cutText(enc byte, b []byte) (text, rest []byte) {
+	if enc != EncodingUTF16 && enc != EncodingUTF16BE {
+		for i, c := range b {
+			if c == 0 {
+				return b[:i], b[i+1:]
+			}
+		}
+		return b, nil
+	}
+
+	// the terminator is 2 zero bytes at a character boundary
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			return b[:i], b[i+2:]
+		}
+	}
+
+	return b, nil
+}
+
+// decodeText decodes b in the encoding enc.
+func decodeText(enc byte, b []byte) (string, error) {
+	switch enc {
+	case EncodingISO88591:
+		// ISO-8859-1 is the first 256 code points of Unicode
+		rs := make([]rune, len(b))
+		for i, c := range b {
+			rs[i] = rune(c)
+		}
+		return string(rs), nil
+	case EncodingUTF16:
+		if len(b) < 2 {
+			return "", nil
+		}
+
+		switch {
+		case b[0] == 0xfe && b[1] == 0xff:
+			return decodeUTF16(b[2:], false), nil
+		case b[0] == 0xff && b[1] == 0xfe:
+			return decodeUTF16(b[2:], true), nil
+		}
+		// the byte order mark is required, but big endian is the default
+		return decodeUTF16(b, false), nil
+	case EncodingUTF16BE:
+		return decodeUTF16(b, false), nil
+	case EncodingUTF8:
+		if !utf8.Valid(b) {
+			return "", errors.New("id3: invalid UTF-8 text")
+		}
+		return string(b), nil
+	}
+
+	return "", fmt.Errorf("id3: invalid text encoding %d", enc)
+}
+
+// decodeUTF16 decodes UTF-16 text in the given byte order.
+func decodeUTF16(b []byte, littleEndian bool) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		if littleEndian {
+			u[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		} else {
+			u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		}
+	}
+
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,112 @@
+package id3
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// V1Size is the size of an ID3v1 tag.
+	V1Size = 128
+
+	// V1ExtendedSize is the size of the extended "TAG+" block
+	// that comes before an ID3v1 tag.
+	V1ExtendedSize = 227
+)
+
+// V1Tag is an ID3v1 or ID3v1.1 tag, with the fields of the extended
+// "TAG+" block when there is one.
+type V1Tag struct {
+	Title   string
+	Artist  string
+	Album   string
+	Year    int
+	Comment string
+
+	// Track is the track number of ID3v1.1, or 0 when it is not available.
+	Track int
+
+	// Genre is the index in Genres, or 255 when it is not set.
+	Genre int
+
+	// Speed is the speed of the extended block from 1 (slow)
+	// to 4 (hardcore), or 0 when it is not available.
+	Speed int
+
+	// ExtendedGenre is the free-form genre of the extended block.
+	ExtendedGenre string
+
+	// StartTime and EndTime are the times like "mmm:ss"
+	// of the extended block.
+	StartTime string
+	EndTime   string
+}
+
+// ParseV1 parses an ID3v1 tag in b, which is either V1Size bytes of the tag,
+// or V1ExtendedSize+V1Size bytes of the extended block and the tag.
+func ParseV1(b []byte) (*V1Tag, error) {
+	var ext []byte
+	if len(b) == V1ExtendedSize+V1Size {
+		ext, b = b[:V1ExtendedSize], b[V1ExtendedSize:]
+		if string(ext[:4]) != "TAG+" {
+			return nil, errors.New("id3: invalid extended ID3v1 tag")
+		}
+	}
+
+	if len(b) != V1Size || string(b[:3]) != "TAG" {
+		return nil, errors.New("id3: invalid ID3v1 tag")
+	}
+
+	t := &V1Tag{
+		Title:   v1Text(b[3:33]),
+		Artist:  v1Text(b[33:63]),
+		Album:   v1Text(b[63:93]),
+		Comment: v1Text(b[97:127]),
+		Genre:   int(b[127]),
+	}
+	t.Year, _ = strconv.Atoi(v1Text(b[93:97]))
+
+	// ID3v1.1 has the track number at the end of the comment
+	if b[125] == 0 && b[126] != 0 {
+		t.Comment = v1Text(b[97:125])
+		t.Track = int(b[126])
+	}
+
+	if ext != nil {
+		// the fields continue the ones of the tag
+		t.Title += v1Text(ext[4:64])
+		t.Artist += v1Text(ext[64:124])
+		t.Album += v1Text(ext[124:184])
+		t.Speed = int(ext[184])
+		t.ExtendedGenre = v1Text(ext[185:215])
+		t.StartTime = v1Text(ext[215:221])
+		t.EndTime = v1Text(ext[221:227])
+	}
+
+	return t, nil
+}
+
+// GenreName returns the name of the genre, or an empty string
+// when it is not set.
+func (t *V1Tag) GenreName() string {
+	if t.ExtendedGenre != "" {
+		return t.ExtendedGenre
+	}
+
+	if t.Genre < len(Genres) {
+		return Genres[t.Genre]
+	}
+
+	return ""
+}
+
+// v1Text decodes an ISO-8859-1 field padded with zero bytes or spaces.
+func v1Text(b []byte) string {
+	s, _ := decodeText(EncodingISO88591, b)
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+
+	return strings.TrimRight(s, " ")
+}
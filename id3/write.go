@@ -0,0 +1,373 @@
+package id3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// DefaultPadding is the size of the padding of a tag written by WriteFile
+// when the file is rewritten, which lets later edits be done in place.
+const DefaultPadding = 1024
+
+// NewTag returns an empty tag of the version, which is 3 or 4 to be written.
+func NewTag(version int) *Tag {
+	return &Tag{Version: version}
+}
+
+// Marshal returns the tag with the given size of padding.
+// The frames are written as they are, without unsynchronisation
+// and compression, except that the UTF-8 and UTF-16BE texts of a tag
+// of version 2.3, which doesn't have them, are re-encoded in UTF-16.
+// A tag with FlagFooter can't have padding.
+func (t *Tag) Marshal(padding int) ([]byte, error) {
+	if t.Version != 3 && t.Version != 4 {
+		return nil, fmt.Errorf("id3: writing version 2.%d is not supported", t.Version)
+	}
+
+	footer := t.Version == 4 && t.Flags&FlagFooter != 0
+	if footer && padding > 0 {
+		return nil, errors.New("id3: a tag with a footer can't have padding")
+	}
+
+	var body []byte
+	for _, f := range t.Frames {
+		if len(f.ID) != 4 || !validID([]byte(f.ID)) {
+			return nil, fmt.Errorf("id3: invalid frame ID %q", f.ID)
+		}
+
+		data := f.Data
+		if t.Version == 3 {
+			var err error
+			if data, err = v23Data(f); err != nil {
+				return nil, err
+			}
+		}
+
+		body = append(body, f.ID...)
+		if t.Version == 4 {
+			if len(data) >= 1<<28 {
+				return nil, fmt.Errorf("id3: frame %s is too large", f.ID)
+			}
+			body = append(body, syncsafeBytes(len(data))...)
+		} else {
+			body = binary.BigEndian.AppendUint32(body, uint32(len(data)))
+		}
+		// no flags
+		body = append(body, 0, 0)
+		body = append(body, data...)
+	}
+	body = append(body, make([]byte, padding)...)
+
+	if len(body) >= 1<<28 {
+		return nil, errors.New("id3: tag is too large")
+	}
+
+	// the flags of what is not written are cleared
+	flags := t.Flags & FlagExperimental
+	if footer {
+		flags |= FlagFooter
+	}
+
+	b := append([]byte{'I', 'D', '3', byte(t.Version), 0, flags}, syncsafeBytes(len(body))...)
+	b = append(b, body...)
+	if footer {
+		b = append(b, '3', 'D', 'I', byte(t.Version), 0, flags)
+		b = append(b, syncsafeBytes(len(body))...)
+	}
+
+	return b, nil
+}
+
+// v23Data returns the content of the frame f for version 2.3,
+// which has the texts in UTF-8 and UTF-16BE re-encoded in UTF-16.
+func v23Data(f *Frame) ([]byte, error) {
+	if len(f.Data) == 0 || f.Data[0] != EncodingUTF8 && f.Data[0] != EncodingUTF16BE {
+		return f.Data, nil
+	}
+
+	enc := f.Data[0]
+	b := []byte{EncodingUTF16}
+	switch {
+	case f.ID == "COMM" || f.ID == "USLT":
+		// the lyrics have the layout of a comment
+		c, err := f.Comment()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, f.Data[1:4]...)
+		b = append(b, encodeText(EncodingUTF16, c.Description)...)
+		b = append(b, terminator(EncodingUTF16)...)
+		b = append(b, encodeText(EncodingUTF16, c.Text)...)
+	case f.ID == "TXXX":
+		desc, value := cutText(enc, f.Data[1:])
+		d, err := decodeText(enc, desc)
+		if err != nil {
+			return nil, err
+		}
+		v, err := decodeText(enc, value)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, encodeText(EncodingUTF16, d)...)
+		b = append(b, terminator(EncodingUTF16)...)
+		b = append(b, encodeText(EncodingUTF16, strings.TrimRight(v, "\x00"))...)
+	case f.ID[0] == 'T':
+		// the values are joined as SetText does
+		values, err := f.Text()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, encodeText(EncodingUTF16, strings.Join(values, "/"))...)
+	case f.ID == "APIC" || f.ID == "WXXX" || f.ID == "GEOB" || f.ID == "SYLT" || f.ID == "USER":
+		return nil, fmt.Errorf("id3: frame %s with text encoding %d can't be written in version 2.3", f.ID, enc)
+	default:
+		// the frame has no text encoding
+		return f.Data, nil
+	}
+
+	return b, nil
+}
+
+// WriteFile writes the tag at the start of the file with the given name
+// in place of the tag that is there, keeping the rest of the file as it is.
+// The file is written in place when the tag fits in the existing one,
+// and is rewritten with DefaultPadding otherwise.
+func WriteFile(name string, t *Tag) error {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var size int
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(f, header); err == nil {
+		size, _ = TagSize(header)
+	} else if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// a footer is for a tag appended to a file,
+	// and leaves no room for padding
+	nt := *t
+	nt.Flags &^= FlagFooter
+
+	b, err := nt.Marshal(0)
+	if err != nil {
+		return err
+	}
+
+	if size > 0 && len(b) <= size {
+		if b, err = nt.Marshal(size - len(b)); err != nil {
+			return err
+		}
+
+		if _, err := f.WriteAt(b, 0); err != nil {
+			return err
+		}
+
+		return f.Close()
+	}
+
+	if b, err = nt.Marshal(DefaultPadding); err != nil {
+		return err
+	}
+
+	return rewriteFile(f, b, int64(size))
+}
+
+// rewriteFile writes tag and the content of f after the offset
+// to a new file that replaces f.
+func rewriteFile(f *os.File, tag []byte, offset int64) (err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.Name()), filepath.Base(f.Name())+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the new file is left only when it has replaced f
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(tag); err != nil {
+		return err
+	}
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(tmp, f); err != nil {
+		return err
+	}
+
+	if err = tmp.Chmod(info.Mode()); err != nil {
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), f.Name())
+	return err
+}
+
+// SetText sets the values of the text frame with the given ID,
+// or removes the frame when there are no values.
+// Version 2.3 has the values joined with "/".
+func (t *Tag) SetText(id string, values ...string) {
+	t.RemoveFrames(id)
+	if len(values) == 0 {
+		return
+	}
+
+	if t.Version < 4 {
+		values = []string{strings.Join(values, "/")}
+	}
+
+	enc := t.textEncoding(values...)
+	b := []byte{enc}
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, terminator(enc)...)
+		}
+		b = append(b, encodeText(enc, v)...)
+	}
+
+	t.Frames = append(t.Frames, &Frame{ID: t.frameID(id), Data: b})
+}
+
+// SetComment sets the comment, replacing the one
+// with the same language and description.
+func (t *Tag) SetComment(c Comment) {
+	for i := 0; i < len(t.Frames); i++ {
+		f := t.Frames[i]
+		if f.ID != t.frameID("COMM") {
+			continue
+		}
+
+		if old, err := f.Comment(); err == nil && old.Language == c.Language && old.Description == c.Description {
+			t.Frames = append(t.Frames[:i], t.Frames[i+1:]...)
+			i--
+		}
+	}
+
+	lang := []byte((c.Language + "XXX")[:3])
+	enc := t.textEncoding(c.Description, c.Text)
+	b := append([]byte{enc}, lang...)
+	b = append(b, encodeText(enc, c.Description)...)
+	b = append(b, terminator(enc)...)
+	b = append(b, encodeText(enc, c.Text)...)
+	t.Frames = append(t.Frames, &Frame{ID: t.frameID("COMM"), Data: b})
+}
+
+// AddPicture adds an APIC frame with the picture.
+func (t *Tag) AddPicture(p *Picture) {
+	enc := t.textEncoding(p.Description)
+	b := []byte{enc}
+	b = append(b, p.MIMEType...)
+	b = append(b, 0, byte(p.Type))
+	b = append(b, encodeText(enc, p.Description)...)
+	b = append(b, terminator(enc)...)
+	b = append(b, p.Data...)
+	t.Frames = append(t.Frames, &Frame{ID: "APIC", Data: b})
+}
+
+// RemoveFrames removes the frames with the given ID.
+func (t *Tag) RemoveFrames(id string) {
+	id = t.frameID(id)
+	fs := t.Frames[:0]
+	for _, f := range t.Frames {
+		if f.ID != id {
+			fs = append(fs, f)
+		}
+	}
+	t.Frames = fs
+}
+
+// frameID returns the frame ID of the tag's version
+// for an ID of version 2.3 and 2.4.
+func (t *Tag) frameID(id string) string {
+	if t.Version == 2 {
+		return v22IDs[id]
+	}
+
+	return id
+}
+
+// textEncoding returns the encoding for the texts,
+// which is ISO-8859-1 when it can have them.
+func (t *Tag) textEncoding(texts ...string) byte {
+	for _, s := range texts {
+		for _, r := range s {
+			if r > 0xff {
+				// UTF-8 is not available before version 2.4
+				if t.Version < 4 {
+					return EncodingUTF16
+				}
+				return EncodingUTF8
+			}
+		}
+	}
+
+	return EncodingISO88591
+}
+
+// encodeText encodes s in the encoding enc.
+func encodeText(enc byte, s string) []byte {
+	switch enc {
+	case EncodingISO88591:
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		return b
+	case EncodingUTF16:
+		// little endian with the byte order mark
+		b := []byte{0xff, 0xfe}
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+		return b
+	case EncodingUTF16BE:
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u>>8), byte(u))
+		}
+		return b
+	}
+
+	return []byte(s)
+}
+
+// terminator returns the terminator of a text in the encoding enc.
+func terminator(enc byte) []byte {
+	if enc == EncodingUTF16 || enc == EncodingUTF16BE {
+		return []byte{0, 0}
+	}
+
+	return []byte{0}
+}
+
+// syncsafeBytes returns n as a 4-byte syncsafe integer.
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
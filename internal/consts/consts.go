@@ -23,11 +23,15 @@ const (
 	SamplesPerGr  = 576
 	GranulesMpeg1 = 2
 
+	// MaxFrameSize is the size of a padded 640 kbps MPEG1 Layer 3 frame
+	// at 32 kHz, the largest frame a free-format stream is expected to have.
+	MaxFrameSize = 2881
+
 	SfBandIndicesLong  = 0
 	SfBandIndicesShort = 1
 )
 
-var SfBandIndices = [2][3][2][]int{
+var SfBandIndices = [3][3][2][]int{
 	{ // MPEG 1
 		{ // Layer 3
 			{0, 4, 8, 12, 16, 20, 24, 30, 36, 44, 52, 62, 74, 90, 110, 134, 162, 196, 238, 288, 342, 418, 576},
@@ -56,6 +60,20 @@ var SfBandIndices = [2][3][2][]int{
 			{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
 		},
 	},
+	{ // MPEG 2.5
+		{ // 11025 Hz
+			{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 116, 140, 168, 200, 238, 284, 336, 396, 464, 522, 576},
+			{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+		},
+		{ // 12000 Hz
+			{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 116, 140, 168, 200, 238, 284, 336, 396, 464, 522, 576},
+			{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+		},
+		{ // 8000 Hz
+			{0, 12, 24, 36, 48, 60, 72, 88, 108, 132, 160, 192, 232, 280, 336, 400, 476, 566, 568, 570, 572, 574, 576},
+			{0, 8, 16, 24, 36, 52, 72, 96, 124, 160, 162, 164, 166, 192},
+		},
+	},
 }
 
 type Version int
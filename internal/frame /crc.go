@@ -0,0 +1,76 @@
+package frame
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pchchv/mp3/internal/consts"
+	"github.com/pchchv/mp3/internal/frameheader"
+	"github.com/pchchv/mp3/internal/layer1"
+	"github.com/pchchv/mp3/internal/layer2"
+)
+
+// crcPolynomial is the generator polynomial of the CRC-16
+// x^16 + x^15 + x^2 + 1 of ISO/IEC 11172-3.
+const crcPolynomial = 0x8005
+
+// CheckCRC reports whether the CRC of the frame data, which starts with
+// the header h, matches. CheckCRC returns true when the frame has no CRC.
+func CheckCRC(h frameheader.FrameHeader, data []byte) bool {
+	if h.ProtectionBit() != 0 {
+		return true
+	}
+
+	if len(data) < 6 {
+		return false
+	}
+
+	// the CRC protects the last 16 bits of the header and
+	// the data after the CRC that the layer tells
+	body := data[6:]
+	var n int
+	switch h.Layer() {
+	case consts.Layer3:
+		n = h.SideInfoSize() * 8
+	case consts.Layer2:
+		n = layer2.ProtectedBits(h, body)
+	case consts.Layer1:
+		n = layer1.ProtectedBits(h)
+	}
+
+	if n > len(body)*8 {
+		return false
+	}
+
+	crc := crc16(0xffff, data[2:4], 16)
+	crc = crc16(crc, body, n)
+	return crc == binary.BigEndian.Uint16(data[4:6])
+}
+
+// crc16 updates crc with the first n bits of data.
+func crc16(crc uint16, data []byte, n int) uint16 {
+	for i := 0; i < n; i++ {
+		bit := uint16(data[i/8]>>(7-i%8)) & 1
+		if crc>>15^bit != 0 {
+			crc = crc<<1 ^ crcPolynomial
+		} else {
+			crc <<= 1
+		}
+	}
+	return crc
+}
+
+// checkCRC reads the frame with the header h after the header,
+// which is unread, and reports whether its CRC matches.
+func checkCRC(source FullReader, h frameheader.FrameHeader, framesize int) (bool, error) {
+	data := make([]byte, framesize)
+	binary.BigEndian.PutUint32(data, uint32(h))
+	n, err := source.ReadFull(data[4:])
+	source.Unread(data[4 : 4+n])
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	// a truncated frame is found by reading it
+	return CheckCRC(h, data[:4+n]), nil
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/pchchv/mp3/internal/consts"
 	"github.com/pchchv/mp3/internal/frameheader"
 	"github.com/pchchv/mp3/internal/imdct"
+	"github.com/pchchv/mp3/internal/layer1"
+	"github.com/pchchv/mp3/internal/layer2"
 	"github.com/pchchv/mp3/internal/maindata"
 	"github.com/pchchv/mp3/internal/sideinfo"
 )
@@ -168,20 +170,134 @@ func init() {
 }
 
 type Frame struct {
-	header       frameheader.FrameHeader
-	sideInfo     *sideinfo.SideInfo
-	mainData     *maindata.MainData
-	mainDataBits *bits.Bits
-	store        [2][32][18]float32
-	v_vec        [2][1024]float32
+	header         frameheader.FrameHeader
+	freeFormatSize int
+	sideInfo       *sideinfo.SideInfo
+	mainData       *maindata.MainData
+	mainDataBits   *bits.Bits
+	store          [2][32][18]float32
+	v_vec          [2][1024]float32
+	crcValid       bool
+	// spectrum is whether mainData.Is is ready for the synthesis
+	spectrum bool
+	// lastIs and lastSideInfo are the input of the last synthesis,
+	// which is of the previous frame until the frame is decoded or
+	// concealed, and is used to conceal a frame that can't be decoded
+	lastIs       [2][2][consts.SamplesPerGr]float32
+	lastSideInfo *sideinfo.SideInfo
+	// err is the error of the frame that can't be decoded
+	err error
+	// noReservoir is whether the main data of the frame starts in
+	// previous frames that are not read, which makes the frame silent
+	noReservoir bool
 }
 
 func (f *Frame) SamplingFrequency() (int, error) {
 	return f.header.SamplingFrequencyValue()
 }
 
-func (f *Frame) Decode() []byte {
-	out := make([]byte, f.header.BytesPerFrame())
+// CRCValid reports whether the CRC of the frame matches its data.
+// CRCValid returns true when the frame has no CRC.
+func (f *Frame) CRCValid() bool {
+	return f.crcValid
+}
+
+// NumberOfChannels returns the number of channels of the frame.
+func (f *Frame) NumberOfChannels() int {
+	return f.header.NumberOfChannels()
+}
+
+// Err returns the error of the frame that is read but can't be decoded,
+// which is to be concealed in place of decoding it, or nil.
+func (f *Frame) Err() error {
+	return f.err
+}
+
+// Continue makes the frame take over the state of the synthesis from prev
+// as Read does, for a frame that is read before prev is decoded or concealed.
+func (f *Frame) Continue(prev *Frame) {
+	f.store = prev.store
+	f.v_vec = prev.v_vec
+	f.lastIs = prev.lastIs
+	f.lastSideInfo = prev.lastSideInfo
+}
+
+// Decode decodes the frame and returns the samples of each channel,
+// which are in the range of [-1, 1] but not clipped.
+// Decode must not be called when Err returns an error.
+func (f *Frame) Decode() [][]float32 {
+	if f.noReservoir {
+		return f.Silence()
+	}
+
+	f.computeSpectrum()
+	return f.synthesize()
+}
+
+// Silence returns the samples of each channel in place of decoding
+// the frame, which are of silence after what the previous frame leaves
+// in the synthesis.
+func (f *Frame) Silence() [][]float32 {
+	return f.conceal(func(gr, ch, i int) float32 {
+		return 0
+	})
+}
+
+// Repeat returns the samples of each channel in place of decoding the frame,
+// which are of the input of the synthesis of the previous frame multiplied
+// by gain, so that repeating frames fade out with a gain less than 1.
+func (f *Frame) Repeat(gain float32) [][]float32 {
+	return f.conceal(func(gr, ch, i int) float32 {
+		return f.lastIs[gr][ch][i] * gain
+	})
+}
+
+// Interpolate returns the samples of each channel in place of decoding
+// the frame, which are of the input of the synthesis interpolated linearly
+// between the previous frame and next, the frame after it.
+// next must be given f by Continue before it is decoded.
+func (f *Frame) Interpolate(next *Frame) [][]float32 {
+	next.computeSpectrum()
+	n := float32(f.header.Granules() + 1)
+	return f.conceal(func(gr, ch, i int) float32 {
+		w := float32(gr+1) / n
+		return f.lastIs[gr][ch][i]*(1-w) + next.mainData.Is[gr][ch][i]*w
+	})
+}
+
+// conceal synthesizes the input that the function returns for each
+// granule, channel and index in place of the data of the frame, so that
+// the state of the synthesis is consistent for the next frame.
+func (f *Frame) conceal(input func(gr, ch, i int) float32) [][]float32 {
+	md := &maindata.MainData{}
+	for gr := 0; gr < f.header.Granules(); gr++ {
+		for ch := 0; ch < f.header.NumberOfChannels(); ch++ {
+			for i := range md.Is[gr][ch] {
+				md.Is[gr][ch][i] = input(gr, ch, i)
+			}
+		}
+	}
+	f.mainData = md
+	f.spectrum = true
+
+	// the block types of the previous frame go with its input
+	f.sideInfo = f.lastSideInfo
+	if f.sideInfo == nil {
+		f.sideInfo = &sideinfo.SideInfo{}
+	}
+
+	return f.synthesize()
+}
+
+// computeSpectrum computes the spectrum of a Layer III frame in
+// mainData.Is, that is the input of the synthesis. Layer I and II frames
+// have their subband samples there that are passed to the synthesis as is.
+func (f *Frame) computeSpectrum() {
+	if f.header.Layer() != consts.Layer3 || f.spectrum {
+		return
+	}
+	f.spectrum = true
+
 	nch := f.header.NumberOfChannels()
 	for gr := 0; gr < f.header.Granules(); gr++ {
 		for ch := 0; ch < nch; ch++ {
@@ -192,9 +308,27 @@ func (f *Frame) Decode() []byte {
 		f.stereo(gr)
 		for ch := 0; ch < nch; ch++ {
 			f.antialias(gr, ch)
-			f.hybridSynthesis(gr, ch)
-			f.frequencyInversion(gr, ch)
-			f.subbandSynthesis(gr, ch, out[consts.SamplesPerGr*4*gr:])
+		}
+	}
+}
+
+// synthesize synthesizes mainData.Is and returns the samples of each channel.
+func (f *Frame) synthesize() [][]float32 {
+	nch := f.header.NumberOfChannels()
+	out := make([][]float32, nch)
+	for ch := range out {
+		out[ch] = make([]float32, f.header.SamplesPerFrame())
+	}
+
+	f.lastIs = f.mainData.Is
+	f.lastSideInfo = f.sideInfo
+	for gr := 0; gr < f.header.Granules(); gr++ {
+		for ch := 0; ch < nch; ch++ {
+			if f.header.Layer() == consts.Layer3 {
+				f.hybridSynthesis(gr, ch)
+				f.frequencyInversion(gr, ch)
+			}
+			f.subbandSynthesis(gr, ch, out[ch][consts.SamplesPerGr*gr:])
 		}
 	}
 
@@ -456,12 +590,17 @@ func (f *Frame) antialias(gr int, ch int) {
 	}
 }
 
-func (f *Frame) subbandSynthesis(gr int, ch int, out []byte) {
+func (f *Frame) subbandSynthesis(gr int, ch int, out []float32) {
 	u_vec := make([]float32, 512)
 	s_vec := make([]float32, 32)
-	nch := f.header.NumberOfChannels()
+	ns := 18
+	if f.header.Layer() == consts.Layer1 {
+		// Layer I has only 12 samples per subband
+		ns = 12
+	}
+
 	// setup the n_win windowing vector and the v_vec intermediate vector
-	for ss := 0; ss < 18; ss++ { // loop through 18 samples in 32 subbands
+	for ss := 0; ss < ns; ss++ { // loop through ns samples in 32 subbands
 		copy(f.v_vec[ch][64:1024], f.v_vec[ch][0:1024-64])
 		d := f.mainData.Is[gr][ch]
 		for i := 0; i < 32; i++ { // copy next 32 time samples to a temp vector
@@ -493,32 +632,7 @@ func (f *Frame) subbandSynthesis(gr int, ch int, out []byte) {
 			}
 
 			// sum now contains time sample 32*ss+i
-			// convert to 16-bit signed int
-			samp := int(sum * 32767)
-			if samp > 32767 {
-				samp = 32767
-			} else if samp < -32767 {
-				samp = -32767
-			}
-
-			s := int16(samp)
-			idx := 4 * (32*ss + i)
-			if nch == 1 {
-				// always run in stereo mode and duplicate channels here for mono
-				out[idx] = byte(s)
-				out[idx+1] = byte(s >> 8)
-				out[idx+2] = byte(s)
-				out[idx+3] = byte(s >> 8)
-				continue
-			}
-
-			if ch == 0 {
-				out[idx] = byte(s)
-				out[idx+1] = byte(s >> 8)
-			} else {
-				out[idx+2] = byte(s)
-				out[idx+3] = byte(s >> 8)
-			}
+			out[32*ss+i] = sum
 		}
 	}
 }
@@ -611,6 +725,7 @@ func (f *Frame) hybridSynthesis(gr int, ch int) {
 
 type FullReader interface {
 	ReadFull([]byte) (int, error)
+	Unread([]byte)
 }
 
 func readCRC(source FullReader) error {
@@ -625,24 +740,79 @@ func readCRC(source FullReader) error {
 }
 
 func Read(source FullReader, position int64, prev *Frame) (frame *Frame, startPosition int64, err error) {
-	h, pos, err := frameheader.Read(source, position)
+	var prevHeader frameheader.FrameHeader
+	if prev != nil {
+		prevHeader = prev.header
+	}
+	return read(source, position, prev, prevHeader)
+}
+
+// ReadStart reads the frame with the header h that is known to start at
+// position, e.g. from an index of the frame starts, like Read without
+// the previous frame. The frame is taken as in sync without confirming it
+// with the frames after it, which can be of another version.
+func ReadStart(source FullReader, position int64, h frameheader.FrameHeader) (frame *Frame, startPosition int64, err error) {
+	return read(source, position, nil, h)
+}
+
+// read reads the next frame, whose header is in sync if it is consistent
+// with prevHeader.
+func read(source FullReader, position int64, prev *Frame, prevHeader frameheader.FrameHeader) (frame *Frame, startPosition int64, err error) {
+	h, pos, err := frameheader.Read(source, position, prevHeader)
 	if err != nil {
 		return nil, 0, err
 	}
 
+	// the free format frame size is found once per stream
+	// and then passed from frame to frame
+	freeFormatSize := 0
+	if prev != nil {
+		freeFormatSize = prev.freeFormatSize
+	}
+
+	var framesize int
+	if h.IsFreeFormat() {
+		if freeFormatSize == 0 {
+			if freeFormatSize, err = frameheader.FreeFormatSize(source, h); err != nil {
+				return nil, 0, err
+			}
+		}
+		framesize = h.FreeFormatFrameSize(freeFormatSize)
+	} else if framesize, err = h.FrameSize(); err != nil {
+		return nil, 0, err
+	}
+
+	crcValid := true
 	if h.ProtectionBit() == 0 {
+		if crcValid, err = checkCRC(source, h, framesize); err != nil {
+			return nil, 0, err
+		}
+
 		if err := readCRC(source); err != nil {
 			return nil, 0, err
 		}
 	}
 
-	if h.ID() == consts.Version2_5 {
-		return nil, 0, fmt.Errorf("mp3: MPEG version 2.5 is not supported")
-	} else if h.Layer() != consts.Layer3 {
-		return nil, 0, fmt.Errorf("mp3: only layer3 (want %d; got %d) is supported", consts.Layer3, h.Layer())
+	switch h.Layer() {
+	case consts.Layer3:
+	case consts.Layer2:
+		frame, startPosition, err = readLayer2(source, h, framesize, freeFormatSize, pos, prev)
+	case consts.Layer1:
+		frame, startPosition, err = readLayer1(source, h, framesize, freeFormatSize, pos, prev)
+	default:
+		return nil, 0, fmt.Errorf("mp3: invalid layer %d", h.Layer())
 	}
 
-	si, err := sideinfo.Read(source, h)
+	if h.Layer() != consts.Layer3 {
+		if err != nil {
+			return nil, 0, err
+		}
+
+		frame.crcValid = crcValid
+		return frame, startPosition, nil
+	}
+
+	si, err := sideinfo.Read(source, h, framesize)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -655,20 +825,70 @@ func Read(source FullReader, position int64, prev *Frame) (frame *Frame, startPo
 		prevM = prev.mainDataBits
 	}
 
-	md, mdb, err := maindata.Read(source, prevM, h, si)
+	// a frame whose main data is read but can't be decoded is returned
+	// with the error, and its main data is kept for the next frame
+	md, mdb, err := maindata.Read(source, prevM, h, si, framesize)
+	if err != nil && mdb == nil {
+		return nil, 0, err
+	}
+
+	// a frame whose bit reservoir is not available is not an error,
+	// which happens at the start of a stream that is cut
+	noReservoir := err == maindata.ErrNoReservoir
+	if noReservoir {
+		err = nil
+	}
+
+	nf := &Frame{
+		header:         h,
+		freeFormatSize: freeFormatSize,
+		sideInfo:       si,
+		mainData:       md,
+		mainDataBits:   mdb,
+		crcValid:       crcValid,
+		err:            err,
+		noReservoir:    noReservoir,
+	}
+	if prev != nil {
+		nf.Continue(prev)
+	}
+
+	return nf, pos, nil
+}
+
+func readLayer2(source FullReader, h frameheader.FrameHeader, framesize, freeFormatSize int, pos int64, prev *Frame) (*Frame, int64, error) {
+	samples, err := layer2.Read(source, h, framesize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Layer II has no bit reservoir,
+	// the subband samples are just passed to the synthesis
+	nf := &Frame{
+		header:         h,
+		freeFormatSize: freeFormatSize,
+		mainData:       &maindata.MainData{Is: *samples},
+	}
+	if prev != nil {
+		nf.Continue(prev)
+	}
+
+	return nf, pos, nil
+}
+
+func readLayer1(source FullReader, h frameheader.FrameHeader, framesize, freeFormatSize int, pos int64, prev *Frame) (*Frame, int64, error) {
+	samples, err := layer1.Read(source, h, framesize)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	nf := &Frame{
-		header:       h,
-		sideInfo:     si,
-		mainData:     md,
-		mainDataBits: mdb,
+		header:         h,
+		freeFormatSize: freeFormatSize,
+		mainData:       &maindata.MainData{Is: *samples},
 	}
 	if prev != nil {
-		nf.store = prev.store
-		nf.v_vec = prev.v_vec
+		nf.Continue(prev)
 	}
 
 	return nf, pos, nil
@@ -676,8 +896,8 @@ func Read(source FullReader, position int64, prev *Frame) (frame *Frame, startPo
 
 func getSfBandIndicesArray(header *frameheader.FrameHeader) ([]int, []int) {
 	sfreq := header.SamplingFrequency() // Setup sampling frequency index
-	lsf := header.LowSamplingFrequency()
-	sfBandIndicesShort := consts.SfBandIndices[lsf][sfreq][consts.SfBandIndicesShort]
-	sfBandIndicesLong := consts.SfBandIndices[lsf][sfreq][consts.SfBandIndicesLong]
+	v := header.VersionIndex()
+	sfBandIndicesShort := consts.SfBandIndices[v][sfreq][consts.SfBandIndicesShort]
+	sfBandIndicesLong := consts.SfBandIndices[v][sfreq][consts.SfBandIndicesLong]
 	return sfBandIndicesLong, sfBandIndicesShort
 }
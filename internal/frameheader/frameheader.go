@@ -8,6 +8,16 @@ import (
 	"github.com/pchchv/mp3/internal/consts"
 )
 
+const (
+	// syncMask is the fields that the frames of a stream have in common,
+	// which are the sync word, the version, the layer and the sampling frequency
+	syncMask = 0xfffe0c00
+
+	// syncFrames is the number of frames after a header found by searching
+	// that must be consistent with it
+	syncFrames = 3
+)
+
 // mepg1FrameHeader is MPEG1 Layer 1-3 frame header.
 type FrameHeader uint32
 
@@ -26,6 +36,13 @@ func (f FrameHeader) BitrateIndex() int {
 	return int(f&0x0000f000) >> 12
 }
 
+// IsFreeFormat returns whether the frame is in free format,
+// that is, its bitrate is not one of the listed ones and
+// the frame size has to be found from the distance between frames.
+func (f FrameHeader) IsFreeFormat() bool {
+	return f.BitrateIndex() == 0
+}
+
 // LowSamplingFrequency returns whether the frame is encoded in a
 // low sampling frequency => 0 = MPEG-1, 1 = MPEG-2/2.5
 func (f FrameHeader) LowSamplingFrequency() int {
@@ -35,19 +52,33 @@ func (f FrameHeader) LowSamplingFrequency() int {
 	return 1
 }
 
+// VersionIndex returns the index of the version in per-version
+// tables => 0 = MPEG-1, 1 = MPEG-2, 2 = MPEG-2.5
+func (f FrameHeader) VersionIndex() int {
+	switch f.ID() {
+	case consts.Version1:
+		return 0
+	case consts.Version2_5:
+		return 2
+	}
+	return 1
+}
+
 // SamplingFrequency returns the SamplingFrequency in Hz stored in position 11,10
 func (f FrameHeader) SamplingFrequency() consts.SamplingFrequency {
 	return consts.SamplingFrequency(int(f&0x00000c00) >> 10)
 }
 
 func (f FrameHeader) SamplingFrequencyValue() (int, error) {
+	// MPEG-2 halves the MPEG-1 frequencies and MPEG-2.5 quarters them
+	shift := uint(f.VersionIndex())
 	switch f.SamplingFrequency() {
 	case 0:
-		return 44100 >> uint(f.LowSamplingFrequency()), nil
+		return 44100 >> shift, nil
 	case 1:
-		return 48000 >> uint(f.LowSamplingFrequency()), nil
+		return 48000 >> shift, nil
 	case 2:
-		return 32000 >> uint(f.LowSamplingFrequency()), nil
+		return 32000 >> shift, nil
 	}
 	return 0, errors.New("mp3: frame header has invalid sample frequency")
 }
@@ -80,7 +111,7 @@ func (f FrameHeader) UseIntensityStereo() bool {
 	if f.Mode() != consts.ModeJointStereo {
 		return false
 	}
-	return f.modeExtension()&0x1 != 0
+	return f.ModeExtension()&0x1 != 0
 }
 
 // UseMSStereo returns a boolean value indicating whether the
@@ -89,7 +120,7 @@ func (f FrameHeader) UseMSStereo() bool {
 	if f.Mode() != consts.ModeJointStereo {
 		return false
 	}
-	return f.modeExtension()&0x2 != 0
+	return f.ModeExtension()&0x2 != 0
 }
 
 // Copyright returns whether or not
@@ -111,10 +142,26 @@ func (f FrameHeader) Emphasis() int {
 }
 
 func (f FrameHeader) BytesPerFrame() int {
-	return consts.SamplesPerGr * f.Granules() * 4
+	return f.SamplesPerFrame() * 4
+}
+
+// SamplesPerFrame returns the number of samples per channel in the frame.
+func (f FrameHeader) SamplesPerFrame() int {
+	if f.Layer() == consts.Layer1 {
+		return 384
+	}
+	return consts.SamplesPerGr * f.Granules()
 }
 
 func (f FrameHeader) Granules() int {
+	switch f.Layer() {
+	case consts.Layer1:
+		// Layer I has 384 samples, that fit in 1 granule
+		return 1
+	case consts.Layer2:
+		// Layer II always has 1152 samples, that is the size of 2 granules
+		return consts.GranulesMpeg1
+	}
 	return consts.GranulesMpeg1 >> uint(f.LowSamplingFrequency()) // MPEG2 uses only 1 granule
 }
 
@@ -187,16 +234,47 @@ func (f FrameHeader) Bitrate() int {
 	return bitrates[f.LowSamplingFrequency()][f.Layer()-1][f.BitrateIndex()]
 }
 
+// FrameSize returns the size of the frame in bytes, including the header.
+// The size of free-format frames is not known from the header alone,
+// see FreeFormatFrameSize for them.
 func (f FrameHeader) FrameSize() (int, error) {
+	if f.IsFreeFormat() {
+		return 0, errors.New("mp3: free format frame size can't be computed from the header")
+	}
+
 	freq, err := f.SamplingFrequencyValue()
 	if err != nil {
 		return 0, err
 	}
 
-	size := ((144*f.Bitrate())/freq + int(f.PaddingBit())) >> uint(f.LowSamplingFrequency())
+	switch f.Layer() {
+	case consts.Layer1:
+		// Layer I frames consist of 4 byte slots
+		return (12*f.Bitrate()/freq + f.PaddingBit()) * 4, nil
+	case consts.Layer2:
+		return 144*f.Bitrate()/freq + f.PaddingBit(), nil
+	}
+
+	// MPEG-2 and MPEG-2.5 Layer III frames have half the samples, and so half
+	// the size, but their padding slot is a whole byte
+	size := (144*f.Bitrate()/freq)>>uint(f.LowSamplingFrequency()) + f.PaddingBit()
 	return size, nil
 }
 
+// FreeFormatFrameSize returns the size of the free-format frame in bytes,
+// given the size of an unpadded frame of the same stream.
+func (f FrameHeader) FreeFormatFrameSize(unpadded int) int {
+	return unpadded + f.PaddingBit()*f.slotSize()
+}
+
+// slotSize returns the size in bytes of the padding slot.
+func (f FrameHeader) slotSize() int {
+	if f.Layer() == consts.Layer1 {
+		return 4
+	}
+	return 1
+}
+
 func (f FrameHeader) SideInfoSize() (sideinfo_size int) {
 	mono := f.Mode() == consts.ModeSingleChannel
 	if f.LowSamplingFrequency() == 1 {
@@ -216,10 +294,10 @@ func (f FrameHeader) SideInfoSize() (sideinfo_size int) {
 	return
 }
 
-// modeExtension returns the mode_extension -
+// ModeExtension returns the mode_extension -
 // for use with Joint Stereo -
 // stored in position 4,5
-func (f FrameHeader) modeExtension() int {
+func (f FrameHeader) ModeExtension() int {
 	return int(f&0x00000030) >> 4
 }
 
@@ -227,7 +305,13 @@ type FullReader interface {
 	ReadFull([]byte) (int, error)
 }
 
-func Read(source FullReader, position int64) (h FrameHeader, startPosition int64, err error) {
+// Read reads the next frame header from source at position.
+// prev is the header of the previous frame, or 0 when it is not known,
+// e.g. at the start of the stream or after seeking. A header right after
+// the previous frame that is consistent with it is in sync, and others,
+// which are found by searching the stream for the sync word, are accepted
+// only when the frames after them are consistent with them.
+func Read(source FullReader, position int64, prev FrameHeader) (h FrameHeader, startPosition int64, err error) {
 	buf := make([]byte, 4)
 	if n, err := source.ReadFull(buf); n < 4 {
 		if err == io.EOF {
@@ -245,7 +329,46 @@ func Read(source FullReader, position int64) (h FrameHeader, startPosition int64
 	b3 := uint32(buf[2])
 	b4 := uint32(buf[3])
 	header := FrameHeader((b1 << 24) | (b2 << 16) | (b3 << 8) | (b4 << 0))
-	for !header.IsValid() {
+	synced := prev != 0 && header&syncMask == prev&syncMask
+	for {
+		// a free-format frame can't follow a frame with a bitrate
+		if header.IsValid() && (prev == 0 || prev.IsFreeFormat() || !header.IsFreeFormat()) {
+			if synced {
+				break
+			}
+
+			ok, err := confirm(source, header)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			if ok {
+				break
+			}
+		}
+		synced = false
+
+		// tags can be between frames, which must not be searched for headers
+		if s, ok := source.(TagSkipper); ok && isTagStart(b1, b2, b3) {
+			s.Unread([]byte{byte(b1), byte(b2), byte(b3), byte(b4)})
+			n, err := s.SkipTag()
+			if err != nil {
+				if err == io.EOF {
+					return 0, 0, &consts.UnexpectedEOF{At: "readHeader (3)"}
+				}
+				return 0, 0, err
+			}
+
+			if n > 0 {
+				return Read(source, position+n, prev)
+			}
+
+			// not a tag, whose bytes are read again
+			if _, err := source.ReadFull(buf); err != nil {
+				return 0, 0, err
+			}
+		}
+
 		buf := make([]byte, 1)
 		b1, b2, b3 = b2, b3, b4
 		if _, err := source.ReadFull(buf); err != nil {
@@ -260,13 +383,157 @@ func Read(source FullReader, position int64) (h FrameHeader, startPosition int64
 		position++
 	}
 
-	// If get here have found the sync word,
-	// and can decode the header which is in
-	// the low 20 bits of the 32-bit sync+header word.
-	if header.BitrateIndex() == 0 {
-		return 0, 0, fmt.Errorf("mp3: free bitrate format is not supported. Header word is 0x%08x at position %d",
-			header, position)
+	return header, position, nil
+}
+
+// confirm reports whether the frames after the header h, which has just
+// been read from source, are consistent with it. Up to syncFrames frames
+// are read ahead, which are unread. The frames are consistent as well when
+// the stream or the frames end before them.
+func confirm(source FullReader, h FrameHeader) (bool, error) {
+	s, ok := source.(UnreadFullReader)
+	if !ok {
+		return true, nil
 	}
 
-	return header, position, nil
+	var read []byte
+	defer func() {
+		s.Unread(read)
+	}()
+
+	for i := 0; i < syncFrames; i++ {
+		size, err := h.FrameSize()
+		if h.IsFreeFormat() {
+			// the size of a free-format frame is found with the next header
+			unpadded, err := FreeFormatSize(s, h)
+			if err != nil {
+				return false, nil
+			}
+			size = h.FreeFormatFrameSize(unpadded)
+		} else if err != nil {
+			return false, err
+		}
+
+		// the rest of the frame and the next header
+		buf := make([]byte, size)
+		n, err := s.ReadFull(buf)
+		read = append(read, buf[:n]...)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+
+		if n < size {
+			// the stream ends in the frame, or right after it for
+			// a free-format frame, whose size has no next header then
+			return true, nil
+		}
+
+		b := buf[size-4:]
+		if isTrailerStart(b) {
+			return true, nil
+		}
+
+		next := FrameHeader(uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]))
+		if !next.IsValid() || next&syncMask != h&syncMask {
+			return false, nil
+		}
+		h = next
+	}
+
+	return true, nil
+}
+
+// isTrailerStart returns whether the bytes can be the start of a tag
+// or a block that can follow the frames.
+func isTrailerStart(b []byte) bool {
+	switch string(b[:3]) {
+	case "ID3", "3DI", "TAG", "APE", "LYR":
+		return true
+	}
+	return false
+}
+
+// TagSkipper is a FullReader that can skip an ID3v2 tag between frames.
+type TagSkipper interface {
+	FullReader
+	Unread([]byte)
+
+	// SkipTag skips the tag at the current position and returns
+	// the number of bytes skipped, which is 0 when there is no tag.
+	SkipTag() (int64, error)
+}
+
+// isTagStart returns whether the bytes can be the start of the header
+// or the footer of an ID3v2 tag.
+func isTagStart(b1, b2, b3 uint32) bool {
+	s := string([]byte{byte(b1), byte(b2), byte(b3)})
+	return s == "ID3" || s == "3DI"
+}
+
+// UnreadFullReader is a FullReader that can push read data back.
+type UnreadFullReader interface {
+	FullReader
+	Unread([]byte)
+}
+
+// FreeFormatSize returns the size in bytes of an unpadded frame of the
+// free-format stream whose header h has just been read from source.
+// The size is the distance to the next header of the same stream,
+// which must be followed by another header at the same distance, as a
+// header can be found by chance in the data of the frame. The data read
+// ahead to find them is unread.
+// The last frame of a stream extends to the end of the stream.
+func FreeFormatSize(source UnreadFullReader, h FrameHeader) (int, error) {
+	// the fields that can't change between frames of a free-format stream:
+	// sync, version, layer, bitrate and sampling frequency
+	const mask = 0xfffefc00
+	buf := make([]byte, 2*consts.MaxFrameSize)
+	n, err := source.ReadFull(buf)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	// the stream ends in the data read ahead
+	eof := n < len(buf)
+	buf = buf[:n]
+	source.Unread(buf)
+
+	// header returns the header at i in buf if it is of the same stream
+	header := func(i int) (FrameHeader, bool) {
+		next := FrameHeader(uint32(buf[i])<<24 | uint32(buf[i+1])<<16 | uint32(buf[i+2])<<8 | uint32(buf[i+3]))
+		return next, next.IsValid() && next&mask == h&mask
+	}
+
+	// the next header can't be inside the side info
+	slot := h.slotSize()
+	size := 4 + n - h.PaddingBit()*slot
+	for i := h.SideInfoSize(); i+4 <= n && 4+i <= consts.MaxFrameSize; i++ {
+		next, ok := header(i)
+		if !ok {
+			continue
+		}
+
+		// the header after the next frame, unless the next frame
+		// is the last one, which ends at the end of the stream
+		unpadded := 4 + i - h.PaddingBit()*slot
+		j := i + unpadded + next.PaddingBit()*slot
+		if j+4 > n {
+			if eof && j == n {
+				size = unpadded
+				break
+			}
+			continue
+		}
+
+		if _, ok := header(j); ok || isTrailerStart(buf[j:]) {
+			size = unpadded
+			break
+		}
+	}
+
+	if size <= h.SideInfoSize() || size > consts.MaxFrameSize {
+		return 0, fmt.Errorf("mp3: invalid free format frame size %d", size)
+	}
+
+	return size, nil
 }
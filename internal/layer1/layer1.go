@@ -0,0 +1,132 @@
+package layer1
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pchchv/mp3/internal/bits"
+	"github.com/pchchv/mp3/internal/consts"
+	"github.com/pchchv/mp3/internal/frameheader"
+)
+
+var scalefactors = [64]float32{}
+
+func init() {
+	for i := range scalefactors {
+		scalefactors[i] = float32(2.0 * math.Pow(2.0, -float64(i)/3.0))
+	}
+}
+
+type FullReader interface {
+	ReadFull([]byte) (int, error)
+}
+
+// Samples are the dequantized subband samples of a Layer I frame.
+// [2][2][576] means [gr][ch][sb*18+ss] as Layer III main data.
+// Layer I has 12 samples per subband, so only ss 0-11 of the
+// first granule are used.
+type Samples [2][2][consts.SamplesPerGr]float32
+
+// Read reads the rest of a Layer I frame whose header has already been read
+// and returns its dequantized subband samples.
+func Read(source FullReader, header frameheader.FrameHeader, framesize int) (*Samples, error) {
+	if framesize > consts.MaxFrameSize {
+		return nil, fmt.Errorf("mp3: framesize = %d", framesize)
+	}
+
+	size := framesize - 4 // sync+header
+	// CRC is 2 bytes
+	if header.ProtectionBit() == 0 {
+		size -= 2
+	}
+
+	buf := make([]byte, size)
+	if n, err := source.ReadFull(buf); n < size {
+		if err == io.EOF {
+			return nil, &consts.UnexpectedEOF{At: "layer1.Read"}
+		}
+		return nil, fmt.Errorf("mp3: couldn't read layer1 data %d bytes: %v", size, err)
+	}
+	m := bits.New(buf)
+
+	nch := header.NumberOfChannels()
+	bound := 32
+	if header.Mode() == consts.ModeJointStereo {
+		// subbands from the bound upwards are coded in intensity stereo
+		bound = 4 + 4*header.ModeExtension()
+	}
+
+	// allocations are the number of bits per sample minus 1,
+	// 0 means no samples
+	var allocation [2][32]int
+	for sb := 0; sb < 32; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if sb >= bound && ch == 1 {
+				allocation[1][sb] = allocation[0][sb]
+				continue
+			}
+
+			allocation[ch][sb] = m.Bits(4)
+			if allocation[ch][sb] == 15 {
+				return nil, fmt.Errorf("mp3: invalid layer1 bit allocation in subband %d", sb)
+			}
+		}
+	}
+
+	var scalefactor [2][32]int
+	for sb := 0; sb < 32; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if allocation[ch][sb] != 0 {
+				scalefactor[ch][sb] = m.Bits(6)
+			}
+		}
+	}
+
+	s := &Samples{}
+	for ss := 0; ss < 12; ss++ {
+		for sb := 0; sb < 32; sb++ {
+			var codes [2]int
+			for ch := 0; ch < nch; ch++ {
+				if allocation[ch][sb] == 0 {
+					continue
+				}
+
+				if sb >= bound && ch == 1 {
+					// samples above the bound are shared by both channels
+					codes[1] = codes[0]
+					continue
+				}
+				codes[ch] = m.Bits(allocation[ch][sb] + 1)
+			}
+
+			for ch := 0; ch < nch; ch++ {
+				a := allocation[ch][sb]
+				if a == 0 {
+					continue
+				}
+
+				nlevels := 1<<(a+1) - 1
+				s[0][ch][sb*18+ss] = dequantize(nlevels, codes[ch]) * scalefactors[scalefactor[ch][sb]]
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// ProtectedBits returns the number of bits after the header and the CRC
+// that the CRC of a Layer I frame protects, which is the bit allocation.
+func ProtectedBits(header frameheader.FrameHeader) int {
+	bound := 32
+	if header.Mode() == consts.ModeJointStereo {
+		bound = 4 + 4*header.ModeExtension()
+	}
+	return 4 * (bound*header.NumberOfChannels() + 32 - bound)
+}
+
+// dequantize maps a code of a quantizer with nlevels levels
+// to a fraction in the range (-1, 1).
+func dequantize(nlevels int, code int) float32 {
+	return float32(2*code-(nlevels-1)) / float32(nlevels)
+}
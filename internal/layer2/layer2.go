@@ -0,0 +1,305 @@
+package layer2
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pchchv/mp3/internal/bits"
+	"github.com/pchchv/mp3/internal/consts"
+	"github.com/pchchv/mp3/internal/frameheader"
+)
+
+var (
+	scalefactors = [64]float32{}
+	// sbQuantTable holds the number of subbands and,
+	// for each of them, the index into bitAllocTable
+	sbQuantTable = [5]struct {
+		sbLimit int
+		offsets [30]int
+	}{
+		// ISO/IEC 11172-3 Table B.2a
+		{27, [30]int{7, 7, 7, 6, 6, 6, 6, 6, 6, 6, 6, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 0, 0, 0, 0}},
+		// ISO/IEC 11172-3 Table B.2b
+		{30, [30]int{7, 7, 7, 6, 6, 6, 6, 6, 6, 6, 6, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 0, 0, 0, 0, 0, 0, 0}},
+		// ISO/IEC 11172-3 Table B.2c
+		{8, [30]int{5, 5, 2, 2, 2, 2, 2, 2}},
+		// ISO/IEC 11172-3 Table B.2d
+		{12, [30]int{5, 5, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}},
+		// ISO/IEC 13818-3 Table B.1
+		{30, [30]int{4, 4, 4, 4, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+	}
+	// bitAllocTable holds the number of bits of the allocation
+	// and the index into offsetTable
+	bitAllocTable = [8]struct {
+		nbal   int
+		offset int
+	}{
+		{2, 0}, {2, 3}, {3, 3}, {3, 1}, {4, 2}, {4, 3}, {4, 4}, {4, 5},
+	}
+	// offsetTable maps an allocation to the index into quantClasses
+	offsetTable = [6][15]int{
+		{0, 1, 16},
+		{0, 1, 2, 3, 4, 5, 16},
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14},
+		{0, 1, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 16},
+		{0, 2, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+	}
+	// quantClasses holds the quantizers an allocation refers to
+	quantClasses = [17]quantClass{
+		{3, true, 5},
+		{5, true, 7},
+		{7, false, 3},
+		{9, true, 10},
+		{15, false, 4},
+		{31, false, 5},
+		{63, false, 6},
+		{127, false, 7},
+		{255, false, 8},
+		{511, false, 9},
+		{1023, false, 10},
+		{2047, false, 11},
+		{4095, false, 12},
+		{8191, false, 13},
+		{16383, false, 14},
+		{32767, false, 15},
+		{65535, false, 16},
+	}
+)
+
+func init() {
+	for i := range scalefactors {
+		scalefactors[i] = float32(2.0 * math.Pow(2.0, -float64(i)/3.0))
+	}
+}
+
+// quantClass is a quantizer with nlevels levels, whose samples take bits
+// bits each or, if grouped, bits bits for three consecutive samples.
+type quantClass struct {
+	nlevels int
+	grouped bool
+	bits    int
+}
+
+type FullReader interface {
+	ReadFull([]byte) (int, error)
+}
+
+// Samples are the dequantized subband samples of a Layer II frame.
+// [2][2][576] means [gr][ch][sb*18+ss], the same layout as the
+// Layer III main data that is fed into the subband synthesis,
+// so that the 36 samples of each subband are split into 2 granules.
+type Samples [2][2][consts.SamplesPerGr]float32
+
+// Read reads the rest of a Layer II frame whose header has already been read
+// and returns its dequantized subband samples.
+func Read(source FullReader, header frameheader.FrameHeader, framesize int) (*Samples, error) {
+	if framesize > consts.MaxFrameSize {
+		return nil, fmt.Errorf("mp3: framesize = %d", framesize)
+	}
+
+	size := framesize - 4 // sync+header
+	// CRC is 2 bytes
+	if header.ProtectionBit() == 0 {
+		size -= 2
+	}
+
+	buf := make([]byte, size)
+	if n, err := source.ReadFull(buf); n < size {
+		if err == io.EOF {
+			return nil, &consts.UnexpectedEOF{At: "layer2.Read"}
+		}
+		return nil, fmt.Errorf("mp3: couldn't read layer2 data %d bytes: %v", size, err)
+	}
+	m := bits.New(buf)
+
+	nch := header.NumberOfChannels()
+	table := sbQuantTable[quantTableIndex(header)]
+	sbLimit := table.sbLimit
+	bound := sbLimit
+	if header.Mode() == consts.ModeJointStereo {
+		// subbands from the bound upwards are coded in intensity stereo
+		if b := 4 + 4*header.ModeExtension(); b < bound {
+			bound = b
+		}
+	}
+
+	// allocations are indices into quantClasses plus 1, 0 means no samples
+	var allocation [2][32]int
+	for sb := 0; sb < sbLimit; sb++ {
+		ba := bitAllocTable[table.offsets[sb]]
+		for ch := 0; ch < nch; ch++ {
+			if sb >= bound && ch == 1 {
+				allocation[1][sb] = allocation[0][sb]
+				continue
+			}
+
+			if a := m.Bits(ba.nbal); a != 0 {
+				allocation[ch][sb] = offsetTable[ba.offset][a-1] + 1
+			}
+		}
+	}
+
+	var scfsi [2][32]int
+	for sb := 0; sb < sbLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if allocation[ch][sb] != 0 {
+				scfsi[ch][sb] = m.Bits(2)
+			}
+		}
+	}
+
+	// each of the 3 parts of 12 samples has its own scalefactor,
+	// scfsi tells which of them are transmitted and which are shared
+	var scalefactor [2][32][3]int
+	for sb := 0; sb < sbLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if allocation[ch][sb] == 0 {
+				continue
+			}
+
+			sf := &scalefactor[ch][sb]
+			sf[0] = m.Bits(6)
+			switch scfsi[ch][sb] {
+			case 0:
+				sf[1] = m.Bits(6)
+				sf[2] = m.Bits(6)
+			case 1:
+				sf[1] = sf[0]
+				sf[2] = m.Bits(6)
+			case 2:
+				sf[1] = sf[0]
+				sf[2] = sf[0]
+			case 3:
+				sf[1] = m.Bits(6)
+				sf[2] = sf[1]
+			}
+		}
+	}
+
+	s := &Samples{}
+	for gr := 0; gr < 12; gr++ {
+		part := gr / 4
+		for sb := 0; sb < sbLimit; sb++ {
+			var codes [2][3]int
+			for ch := 0; ch < nch; ch++ {
+				if allocation[ch][sb] == 0 {
+					continue
+				}
+
+				if sb >= bound && ch == 1 {
+					// samples above the bound are shared by both channels
+					codes[1] = codes[0]
+					continue
+				}
+				codes[ch] = readCodes(m, quantClasses[allocation[ch][sb]-1])
+			}
+
+			for ch := 0; ch < nch; ch++ {
+				a := allocation[ch][sb]
+				if a == 0 {
+					continue
+				}
+
+				sf := scalefactors[scalefactor[ch][sb][part]]
+				for i, c := range codes[ch] {
+					// sample number within the subband is 3*gr+i (0-35)
+					n := 3*gr + i
+					s[n/18][ch][sb*18+n%18] = dequantize(quantClasses[a-1].nlevels, c) * sf
+				}
+			}
+		}
+	}
+
+	// ancillary data is stored here, but we ignore it
+	return s, nil
+}
+
+// ProtectedBits returns the number of bits after the header and the CRC
+// that the CRC of a Layer II frame protects, which are the bit allocation
+// and the scalefactor selection information. buf is the frame data
+// after the CRC.
+func ProtectedBits(header frameheader.FrameHeader, buf []byte) int {
+	m := bits.New(buf)
+	nch := header.NumberOfChannels()
+	table := sbQuantTable[quantTableIndex(header)]
+	bound := table.sbLimit
+	if header.Mode() == consts.ModeJointStereo {
+		if b := 4 + 4*header.ModeExtension(); b < bound {
+			bound = b
+		}
+	}
+
+	var allocation [2][32]int
+	n := 0
+	for sb := 0; sb < table.sbLimit; sb++ {
+		nbal := bitAllocTable[table.offsets[sb]].nbal
+		for ch := 0; ch < nch; ch++ {
+			if sb >= bound && ch == 1 {
+				allocation[1][sb] = allocation[0][sb]
+				continue
+			}
+
+			allocation[ch][sb] = m.Bits(nbal)
+			n += nbal
+		}
+	}
+
+	// scfsi is 2 bits for each subband with samples
+	for sb := 0; sb < table.sbLimit; sb++ {
+		for ch := 0; ch < nch; ch++ {
+			if allocation[ch][sb] != 0 {
+				n += 2
+			}
+		}
+	}
+	return n
+}
+
+// quantTableIndex returns the index into sbQuantTable
+// that depends on the bitrate per channel and the sampling frequency.
+func quantTableIndex(header frameheader.FrameHeader) int {
+	if header.LowSamplingFrequency() == 1 {
+		return 4
+	}
+
+	bitrate := header.Bitrate() / header.NumberOfChannels()
+	freq, _ := header.SamplingFrequencyValue()
+	switch {
+	case header.IsFreeFormat() && freq == 48000:
+		return 0
+	case header.IsFreeFormat():
+		return 1
+	case bitrate <= 48000 && freq == 32000:
+		return 3
+	case bitrate <= 48000:
+		return 2
+	case bitrate <= 80000 || freq == 48000:
+		return 0
+	}
+	return 1
+}
+
+// readCodes reads the codes of 3 consecutive samples of a subband.
+func readCodes(m *bits.Bits, qc quantClass) (codes [3]int) {
+	if !qc.grouped {
+		for i := range codes {
+			codes[i] = m.Bits(qc.bits)
+		}
+		return
+	}
+
+	c := m.Bits(qc.bits)
+	for i := range codes {
+		codes[i] = c % qc.nlevels
+		c /= qc.nlevels
+	}
+	return
+}
+
+// dequantize maps a code of a quantizer with nlevels levels
+// to a fraction in the range (-1, 1).
+func dequantize(nlevels int, code int) float32 {
+	return float32(2*code-(nlevels-1)) / float32(nlevels)
+}
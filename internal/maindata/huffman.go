@@ -25,13 +25,14 @@ func readHuffman(m *bits.Bits, header frameheader.FrameHeader, sideInfo *sideinf
 	// determine region boundaries
 	region_1_start := 0
 	region_2_start := 0
+	sfreq := header.SamplingFrequency()
+	v := header.VersionIndex()
 	if (sideInfo.WinSwitchFlag[gr][ch] == 1) && (sideInfo.BlockType[gr][ch] == 2) {
-		region_1_start = 36                  // sfb[9/3]*3=36
+		// sfb[9/3]*3, which is 36 for all but MPEG 2.5 8 kHz
+		region_1_start = consts.SfBandIndices[v][sfreq][consts.SfBandIndicesShort][3] * 3
 		region_2_start = consts.SamplesPerGr // No Region2 for short block case.
 	} else {
-		sfreq := header.SamplingFrequency()
-		lsf := header.LowSamplingFrequency()
-		l := consts.SfBandIndices[lsf][sfreq][consts.SfBandIndicesLong]
+		l := consts.SfBandIndices[v][sfreq][consts.SfBandIndicesLong]
 		i := sideInfo.Region0Count[gr][ch] + 1
 		if i < 0 || len(l) <= i {
 			return fmt.Errorf("mp3: readHuffman failed: invalid index i: %d", i)
@@ -1,6 +1,7 @@
 package maindata
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
@@ -10,6 +11,11 @@ import (
 	"github.com/pchchv/mp3/internal/sideinfo"
 )
 
+// ErrNoReservoir is returned by Read for a frame whose main data starts
+// in previous frames that are not available, e.g. at the start of a stream
+// that is cut or after a seek.
+var ErrNoReservoir = errors.New("mp3: main data of the previous frames is not available")
+
 var (
 	nSlen2             = initSlen() /* MPEG 2.0 slen for 'normal' mode */
 	scalefacSizesMpeg2 = [3][6][4]int{
@@ -67,13 +73,12 @@ func initSlen() (nSlen2 [512]int) {
 	return
 }
 
-func Read(source FullReader, prev *bits.Bits, header frameheader.FrameHeader, sideInfo *sideinfo.SideInfo) (*MainData, *bits.Bits, error) {
+// Read reads the main data of a Layer III frame whose side info has been read.
+// When the main data is read but can't be decoded, Read returns its bits
+// with the error as they can be needed for decoding the next frame.
+func Read(source FullReader, prev *bits.Bits, header frameheader.FrameHeader, sideInfo *sideinfo.SideInfo, framesize int) (*MainData, *bits.Bits, error) {
 	nch := header.NumberOfChannels()
-	// calculate header audio data size
-	framesize, err := header.FrameSize()
-	if err != nil {
-		return nil, nil, err
-	} else if framesize > 2000 {
+	if framesize > consts.MaxFrameSize {
 		return nil, nil, fmt.Errorf("mp3: framesize = %d", framesize)
 	}
 
@@ -89,8 +94,11 @@ func Read(source FullReader, prev *bits.Bits, header frameheader.FrameHeader, si
 	// main_data_begin indicates how many bytes from previous frames that should be used.
 	// This buffer is later accessed by the Bits function in the same way as the side info is.
 	m, err := read(source, prev, main_data_size, sideInfo.MainDataBegin)
-	if err != nil {
-		// this could be due to not enough data in reservoir
+	if err == ErrNoReservoir {
+		// the frame can't be decoded, but its main data is kept
+		// as it can be needed for decoding the next frame
+		return nil, m, err
+	} else if err != nil {
 		return nil, nil, err
 	}
 
@@ -154,7 +162,7 @@ func getScaleFactorsMpeg2(m *bits.Bits, header frameheader.FrameHeader, sideInfo
 
 		// read Huffman coded data. Skip stuffing bits
 		if err := readHuffman(m, header, sideInfo, md, part_2_start, 0, ch); err != nil {
-			return nil, nil, err
+			return nil, m, err
 		}
 	}
 	// ancillary data is stored here,but we ignore it
@@ -162,11 +170,11 @@ func getScaleFactorsMpeg2(m *bits.Bits, header frameheader.FrameHeader, sideInfo
 }
 
 func read(source FullReader, prev *bits.Bits, size int, offset int) (*bits.Bits, error) {
-	if size > 1500 {
+	if size > consts.MaxFrameSize {
 		return nil, fmt.Errorf("mp3: size = %d", size)
 	}
 	// check that there's data available from previous frames if needed
-	if prev != nil && offset > prev.LenInBytes() {
+	if offset > 0 && (prev == nil || offset > prev.LenInBytes()) {
 		// does not exist, so decoding of this frame is skipped,
 		// but it is necessary to read main_data bits from the
 		// bitstream in case they are needed for decoding the next frame
@@ -177,7 +185,10 @@ func read(source FullReader, prev *bits.Bits, size int, offset int) (*bits.Bits,
 			}
 			return nil, err
 		}
-		return bits.Append(prev, buf), nil
+		if prev == nil {
+			return bits.New(buf), ErrNoReservoir
+		}
+		return bits.Append(prev, buf), ErrNoReservoir
 	}
 
 	// copy data from previous frames
@@ -287,7 +298,7 @@ func getScaleFactorsMpeg1(nch int, m *bits.Bits, header frameheader.FrameHeader,
 
 			// read Huffman coded data. Skip stuffing bits
 			if err := readHuffman(m, header, sideInfo, md, part_2_start, gr, ch); err != nil {
-				return nil, nil, err
+				return nil, m, err
 			}
 		}
 	}
@@ -45,12 +45,9 @@ type SideInfo struct {
 	Count1            [2][2]int    // Not in file, calc by huffman decoder
 }
 
-func Read(source FullReader, header frameheader.FrameHeader) (*SideInfo, error) {
+func Read(source FullReader, header frameheader.FrameHeader, framesize int) (*SideInfo, error) {
 	nch := header.NumberOfChannels()
-	framesize, err := header.FrameSize()
-	if err != nil {
-		return nil, err
-	} else if framesize > 2000 {
+	if framesize > consts.MaxFrameSize {
 		return nil, fmt.Errorf("mp3: framesize = %d\n", framesize)
 	}
 
@@ -0,0 +1,108 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// decoderDelay is the delay in samples of Layer III decoding,
+// that the encoder delay in the LAME header doesn't include.
+const decoderDelay = 529
+
+// LAMEHeader is the LAME extension of the Xing header.
+type LAMEHeader struct {
+	// Encoder is the encoder version like "LAME3.99r".
+	Encoder string
+
+	// Revision is the revision of the LAME header.
+	Revision int
+
+	// VBRMethod is the VBR method, e.g. 1 for CBR, 3-5 for VBR.
+	VBRMethod int
+
+	// Lowpass is the lowpass filter frequency in Hz, or 0 when unknown.
+	Lowpass int
+
+	// Peak is the peak signal amplitude, where 1 is full scale,
+	// or 0 when unknown.
+	Peak float32
+
+	// TrackGain is the ReplayGain of the track ("radio" gain),
+	// or nil when it is not set.
+	TrackGain *ReplayGain
+
+	// AlbumGain is the ReplayGain of the album ("audiophile" gain),
+	// or nil when it is not set.
+	AlbumGain *ReplayGain
+
+	// EncoderDelay is the number of samples the encoder added
+	// at the beginning of the stream.
+	EncoderDelay int
+
+	// Padding is the number of samples the encoder added
+	// at the end of the stream.
+	Padding int
+
+	// MusicLength is the size in bytes of the stream from the frame
+	// with the header on, not counting tags.
+	MusicLength int64
+}
+
+// ReplayGain is a ReplayGain adjustment.
+type ReplayGain struct {
+	// Originator tells who set the gain, e.g. 1 for the artist,
+	// 2 for the user or 3 for the automatic model.
+	Originator int
+
+	// Adjustment is the gain adjustment in dB.
+	Adjustment float64
+}
+
+// parseLAME parses the LAME header that follows the Xing header fields in b.
+// parseLAME returns nil when there is no LAME header.
+func parseLAME(b []byte) *LAMEHeader {
+	if len(b) < 36 {
+		return nil
+	}
+
+	encoder := strings.TrimRight(string(b[:9]), "\x00 ")
+	// ffmpeg writes the LAME header with its own name
+	if !strings.HasPrefix(encoder, "LAME") && !strings.HasPrefix(encoder, "L3.99") &&
+		!strings.HasPrefix(encoder, "Lavf") && !strings.HasPrefix(encoder, "Lavc") {
+		return nil
+	}
+
+	l := &LAMEHeader{
+		Encoder:   encoder,
+		Revision:  int(b[9] >> 4),
+		VBRMethod: int(b[9] & 0xf),
+		Lowpass:   int(b[10]) * 100,
+		// the peak is a fixed point number with 23 fractional bits
+		Peak:        float32(binary.BigEndian.Uint32(b[11:15])) / (1 << 23),
+		TrackGain:   parseReplayGain(binary.BigEndian.Uint16(b[15:17]), 1),
+		AlbumGain:   parseReplayGain(binary.BigEndian.Uint16(b[17:19]), 2),
+		MusicLength: int64(binary.BigEndian.Uint32(b[28:32])),
+	}
+
+	// the delay and the padding are 12 bits each
+	l.EncoderDelay = int(b[21])<<4 | int(b[22])>>4
+	l.Padding = int(b[22]&0xf)<<8 | int(b[23])
+	return l
+}
+
+// parseReplayGain parses a ReplayGain field whose name code should be name.
+func parseReplayGain(v uint16, name int) *ReplayGain {
+	if int(v>>13) != name {
+		return nil
+	}
+
+	g := &ReplayGain{
+		Originator: int(v>>10) & 0x7,
+		Adjustment: float64(v&0x1ff) / 10,
+	}
+	if v&0x200 != 0 {
+		g.Adjustment = -g.Adjustment
+	}
+
+	return g
+}
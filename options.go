@@ -0,0 +1,77 @@
+package mp3
+
+import "github.com/pchchv/mp3/id3"
+
+// Option is an option for NewDecoder.
+type Option func(*Decoder)
+
+// WithGapless sets whether the encoder delay and padding that the LAME
+// header tells are trimmed from the decoded stream. It is enabled by default.
+func WithGapless(enabled bool) Option {
+	return func(d *Decoder) {
+		d.gapless = enabled
+	}
+}
+
+// WithID3v2Handler sets the function that is called with each ID3v2 tag
+// between frames, and its byte offset in the source, when the tag is read
+// while decoding. A tag appended to the stream with a footer is reported
+// by NewDecoder when the source is io.Seeker. The tag at the start
+// of the stream is returned by ID3v2 instead.
+func WithID3v2Handler(f func(tag *id3.Tag, offset int64)) Option {
+	return func(d *Decoder) {
+		d.source.onID3v2 = f
+	}
+}
+
+// WithNativeChannels sets whether the decoded stream has the number of
+// channels of the first frame, which is 1 for single channel streams,
+// in place of always 2. It is disabled by default.
+func WithNativeChannels(enabled bool) Option {
+	return func(d *Decoder) {
+		d.nativeChannels = enabled
+	}
+}
+
+// WithFormat sets the format of the samples of the decoded stream.
+// It is FormatS16LE by default.
+func WithFormat(f Format) Option {
+	return func(d *Decoder) {
+		d.format = f
+	}
+}
+
+// WithDither sets the dither for the conversion to 16-bit integers
+// of FormatS16LE. It is DitherNone by default.
+func WithDither(dither Dither) Option {
+	return func(d *Decoder) {
+		d.dither = dither
+	}
+}
+
+// WithCRCPolicy sets what the decoder does with a frame whose CRC
+// doesn't match. It is CRCIgnore by default.
+func WithCRCPolicy(p CRCPolicy) Option {
+	return func(d *Decoder) {
+		d.crcPolicy = p
+	}
+}
+
+// WithConcealment sets how the decoder conceals a frame that can't be
+// decoded. It is ConcealNone by default. A frame whose CRC doesn't match
+// is concealed as well with CRCConceal, which is replaced with silence
+// when this is ConcealNone.
+func WithConcealment(c Concealment) Option {
+	return func(d *Decoder) {
+		d.concealment = c
+	}
+}
+
+// WithConcealmentHandler sets the function that is called with the byte
+// offset in the source and the error of each frame that is concealed.
+// The error is a *CRCError for a frame whose CRC doesn't match.
+func WithConcealmentHandler(f func(offset int64, err error)) Option {
+	return func(d *Decoder) {
+		d.onConceal = f
+	}
+}
@@ -0,0 +1,325 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Format is the format of the samples of the decoded stream.
+type Format int
+
+const (
+	// FormatS16LE is 16-bit signed integers in little endian,
+	// which is the default.
+	FormatS16LE Format = iota
+
+	// FormatFloat32LE is 32-bit floats in little endian.
+	// The values are about in [-1, 1], but they are not clipped.
+	FormatFloat32LE
+
+	// FormatS24LE is 24-bit signed integers in little endian,
+	// which are packed in 3 bytes.
+	FormatS24LE
+
+	// FormatS32LE is 32-bit signed integers in little endian.
+	FormatS32LE
+)
+
+// Dither is the dither for the conversion to 16-bit integers.
+type Dither int
+
+const (
+	// DitherNone truncates the samples, which is the default.
+	DitherNone Dither = iota
+
+	// DitherTPDF adds noise of triangular distribution
+	// up to 1 LSB to the samples and rounds them.
+	DitherTPDF
+
+	// DitherShaped is DitherTPDF with the first-order noise shaping,
+	// which moves the noise to high frequencies where it is less audible.
+	DitherShaped
+)
+
+// size returns the size in bytes of a sample of a channel.
+func (f Format) size() int64 {
+	switch f {
+	case FormatFloat32LE, FormatS32LE:
+		return 4
+	case FormatS24LE:
+		return 3
+	}
+	return 2
+}
+
+// bytesPerSample returns the size of a sample of all the channels.
+func (d *Decoder) bytesPerSample() int64 {
+	return int64(d.channels) * d.format.size()
+}
+
+// ReadFloat32 reads samples of the decoded stream into buf as float32 values
+// interleaved by channel, like Read but without the conversion to the format,
+// and returns the number of values read, which is a multiple of the number
+// of channels. The values are about in [-1, 1], but they are not clipped.
+// ReadFloat32 returns an error when the position is not at the start
+// of a sample, e.g. after Read with a buffer of an odd size.
+func (d *Decoder) ReadFloat32(buf []float32) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	if len(buf) < d.channels {
+		return 0, io.ErrShortBuffer
+	}
+
+	samples, err := d.prepareSamples(len(buf) / d.channels)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < samples; i++ {
+		for ch, p := range d.pcm {
+			buf[i*d.channels+ch] = p[i]
+		}
+	}
+	d.drop(samples)
+	d.pos += int64(samples) * d.bytesPerSample()
+	return samples * d.channels, nil
+}
+
+// ReadPlanar reads samples of the decoded stream like ReadFloat32,
+// but writes each channel into its own slice, e.g. ReadPlanar(left, right).
+// The number of slices must be the number of channels of the stream.
+// ReadPlanar returns the number of samples read into each slice,
+// which is at most the length of the shortest slice.
+func (d *Decoder) ReadPlanar(channels ...[]float32) (int, error) {
+	if len(channels) != d.channels {
+		return 0, fmt.Errorf("mp3: got %d channels, want %d", len(channels), d.channels)
+	}
+
+	n := len(channels[0])
+	for _, c := range channels[1:] {
+		if len(c) < n {
+			n = len(c)
+		}
+	}
+
+	if n == 0 {
+		return 0, nil
+	}
+
+	samples, err := d.prepareSamples(n)
+	if err != nil {
+		return 0, err
+	}
+
+	for ch, p := range d.pcm {
+		copy(channels[ch], p[:samples])
+	}
+	d.drop(samples)
+	d.pos += int64(samples) * d.bytesPerSample()
+	return samples, nil
+}
+
+// prepareSamples is like prepare, but returns the number of whole samples
+// up to limit that can be read.
+func (d *Decoder) prepareSamples(limit int) (int, error) {
+	if len(d.buf) > 0 {
+		return 0, errors.New("mp3: position is not at the start of a sample")
+	}
+
+	n, err := d.prepare()
+	if err != nil {
+		return 0, err
+	}
+
+	if s := int(n / d.bytesPerSample()); limit > s {
+		limit = s
+	}
+	return limit, nil
+}
+
+// prepare skips the encoder delay and decodes frames until there are
+// samples to read, and returns the number of bytes that can be read
+// before the encoder padding.
+func (d *Decoder) prepare() (int64, error) {
+	for d.pos < d.start {
+		if err := d.fill(); err != nil {
+			return 0, err
+		}
+
+		n := d.buffered()
+		if n > d.start-d.pos {
+			n = d.start - d.pos
+		}
+		d.skip(n)
+		d.pos += n
+	}
+
+	if d.length != invalidLength && d.pos >= d.end {
+		return 0, io.EOF
+	}
+
+	if err := d.fill(); err != nil {
+		return 0, err
+	}
+
+	n := d.buffered()
+	if d.length != invalidLength && n > d.end-d.pos {
+		n = d.end - d.pos
+	}
+	return n, nil
+}
+
+// fill decodes frames until there are samples to read.
+func (d *Decoder) fill() error {
+	for d.buffered() == 0 {
+		if err := d.readFrame(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buffered returns the number of bytes that are decoded and not read yet.
+func (d *Decoder) buffered() int64 {
+	return int64(len(d.buf)) + int64(d.samples())*d.bytesPerSample()
+}
+
+// samples returns the number of samples in d.pcm.
+func (d *Decoder) samples() int {
+	if d.pcm == nil {
+		return 0
+	}
+	return len(d.pcm[0])
+}
+
+// skip skips n bytes that are decoded and not read yet.
+func (d *Decoder) skip(n int64) {
+	m := int64(len(d.buf))
+	if m > n {
+		m = n
+	}
+	d.buf = d.buf[m:]
+	n -= m
+
+	d.drop(int(n / d.bytesPerSample()))
+	if r := n % d.bytesPerSample(); r > 0 {
+		// the rest of the sample is read later
+		d.buf = make([]byte, d.bytesPerSample())
+		d.encode(d.buf, 1)
+		d.buf = d.buf[r:]
+	}
+}
+
+// drop removes the first n samples from d.pcm.
+func (d *Decoder) drop(n int) {
+	for ch := range d.pcm {
+		d.pcm[ch] = d.pcm[ch][n:]
+	}
+}
+
+// appendFrame appends the samples of each channel of a frame to d.pcm.
+// The channels are mixed down or duplicated when the frame has
+// a different number of channels from the stream.
+func (d *Decoder) appendFrame(pcm [][]float32) {
+	if d.pcm == nil {
+		d.pcm = make([][]float32, d.channels)
+	}
+
+	for ch := range d.pcm {
+		switch {
+		case len(pcm) == d.channels:
+			d.pcm[ch] = append(d.pcm[ch], pcm[ch]...)
+		case d.channels == 1:
+			for i := range pcm[0] {
+				d.pcm[ch] = append(d.pcm[ch], (pcm[0][i]+pcm[1][i])/2)
+			}
+		default:
+			d.pcm[ch] = append(d.pcm[ch], pcm[0]...)
+		}
+	}
+}
+
+// encode writes the first n samples of d.pcm to out
+// in the format of the decoded stream, and removes them.
+func (d *Decoder) encode(out []byte, n int) {
+	idx := 0
+	for i := 0; i < n; i++ {
+		for ch, p := range d.pcm {
+			v := p[i]
+			switch d.format {
+			case FormatFloat32LE:
+				binary.LittleEndian.PutUint32(out[idx:], math.Float32bits(v))
+				idx += 4
+			case FormatS24LE:
+				s := clip(int64(float64(v)*(1<<23-1)), 1<<23-1)
+				out[idx] = byte(s)
+				out[idx+1] = byte(s >> 8)
+				out[idx+2] = byte(s >> 16)
+				idx += 3
+			case FormatS32LE:
+				s := clip(int64(float64(v)*(1<<31-1)), 1<<31-1)
+				binary.LittleEndian.PutUint32(out[idx:], uint32(s))
+				idx += 4
+			default:
+				s := int16(d.quantize16(v, ch))
+				out[idx] = byte(s)
+				out[idx+1] = byte(s >> 8)
+				idx += 2
+			}
+		}
+	}
+	d.drop(n)
+}
+
+// quantize16 converts the sample v of the channel ch
+// to a 16-bit signed int with the dither.
+func (d *Decoder) quantize16(v float32, ch int) int64 {
+	if d.dither == DitherNone {
+		return clip(int64(v*32767), 32767)
+	}
+
+	x := float64(v) * 32767
+	if d.dither == DitherShaped {
+		if d.ditherErr == nil {
+			d.ditherErr = make([]float64, d.channels)
+		}
+		// subtract the error of the previous sample
+		x -= d.ditherErr[ch]
+	}
+
+	q := math.Floor(x + d.random() - d.random() + 0.5)
+	if d.dither == DitherShaped {
+		d.ditherErr[ch] = q - x
+	}
+	return clip(int64(q), 32767)
+}
+
+// random returns a pseudo-random number in [0, 1).
+// The sequence is the same for every decoder
+// so that the decoded stream is reproducible.
+func (d *Decoder) random() float64 {
+	if d.rand == 0 {
+		d.rand = 0x9e3779b9
+	}
+
+	// xorshift32
+	d.rand ^= d.rand << 13
+	d.rand ^= d.rand >> 17
+	d.rand ^= d.rand << 5
+	return float64(d.rand) / (1 << 32)
+}
+
+// clip clips v to [-limit, limit].
+func clip(v, limit int64) int64 {
+	if v > limit {
+		return limit
+	} else if v < -limit {
+		return -limit
+	}
+	return v
+}
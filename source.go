@@ -3,12 +3,35 @@ package mp3
 import (
 	"errors"
 	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pchchv/mp3/ape"
+	"github.com/pchchv/mp3/id3"
+	"github.com/pchchv/mp3/internal/frameheader"
 )
 
+const lyricsBegin = "LYRICSBEGIN"
+
 type source struct {
 	reader io.Reader
 	buf    []byte
 	pos    int64
+	// freeFormatSize is the size of unpadded frames of a free-format stream
+	freeFormatSize int
+	// end is the position where the audio ends
+	// before the trailing tags, or 0 when it is unknown
+	end   int64
+	id3v2 *id3.Tag
+	// id3v2Pos and id3v2Size are the position and the size
+	// of the tag at the start that is not read yet
+	id3v2Pos  int64
+	id3v2Size int
+	id3v1     *id3.V1Tag
+	ape       *ape.Tag
+	// onID3v2 is called with the tags after the first one
+	// and their positions, and can be nil
+	onID3v2 func(*id3.Tag, int64)
 }
 
 func (s *source) Seek(position int64, whence int) (n int64, err error) {
@@ -28,6 +51,18 @@ func (s *source) Seek(position int64, whence int) (n int64, err error) {
 }
 
 func (s *source) ReadFull(buf []byte) (n int, err error) {
+	if s.end > 0 && s.pos+int64(len(buf)) > s.end {
+		// the trailing tags are not read as audio
+		if s.pos >= s.end {
+			return 0, io.EOF
+		}
+
+		if n, err = s.ReadFull(buf[:s.end-s.pos]); err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+
 	var read int
 	if s.buf != nil {
 		read = copy(buf, s.buf)
@@ -36,6 +71,7 @@ func (s *source) ReadFull(buf []byte) (n int, err error) {
 		} else {
 			s.buf = nil
 		}
+		s.pos += int64(read)
 
 		if len(buf) == read {
 			return read, nil
@@ -52,7 +88,8 @@ func (s *source) ReadFull(buf []byte) (n int, err error) {
 }
 
 func (s *source) Unread(buf []byte) {
-	s.buf = append(s.buf, buf...)
+	// unread data goes before what is left from a previous unread
+	s.buf = append(append([]byte{}, buf...), s.buf...)
 	s.pos -= int64(len(buf))
 }
 
@@ -79,29 +116,367 @@ func (s *source) skipTags() error {
 			return err
 		}
 	case "ID3":
-		// skip version (2 bytes) and flag (1 byte)
-		buf := make([]byte, 3)
-		if _, err := s.ReadFull(buf); err != nil {
-			return err
+		// the tags that follow are skipped by the search of a frame
+		s.Unread(buf)
+		if _, ok := s.reader.(io.Seeker); ok {
+			return s.skipID3v2()
 		}
 
-		buf = make([]byte, 4)
-		n, err := s.ReadFull(buf)
+		t, _, err := s.readID3v2()
 		if err != nil {
 			return err
-		} else if n != 4 {
+		}
+		s.id3v2 = t
+	case "APE":
+		header := make([]byte, ape.HeaderSize)
+		copy(header, buf)
+		if _, err := s.ReadFull(header[3:]); err != nil {
+			return err
+		}
+
+		size, err := ape.TagSize(header)
+		if err != nil || !ape.IsHeader(header) {
+			s.Unread(header)
 			return nil
 		}
 
-		size := (uint32(buf[0]) << 21) | (uint32(buf[1]) << 14) |
-			(uint32(buf[2]) << 7) | uint32(buf[3])
 		buf = make([]byte, size)
-		if _, err := s.ReadFull(buf); err != nil {
+		copy(buf, header)
+		if _, err := s.ReadFull(buf[ape.HeaderSize:]); err != nil {
 			return err
 		}
+
+		// the tag at the end takes precedence
+		if t, err := ape.Parse(buf); err == nil && s.ape == nil {
+			s.ape = t
+		}
 	default:
 		s.Unread(buf)
 	}
 
 	return nil
 }
+
+// readID3v2 reads the ID3v2 tag at the current position, and returns
+// the tag, which is nil when it can't be read, and the number of bytes read,
+// which is 0 when there is no tag.
+func (s *source) readID3v2() (*id3.Tag, int64, error) {
+	header := make([]byte, id3.HeaderSize)
+	if _, err := s.ReadFull(header); err != nil {
+		return nil, 0, err
+	}
+
+	size, err := id3.TagSize(header)
+	if err != nil {
+		// not a tag, which is left to the search of a frame
+		s.Unread(header)
+		return nil, 0, nil
+	}
+
+	buf := make([]byte, size)
+	copy(buf, header)
+	if _, err := s.ReadFull(buf[id3.HeaderSize:]); err != nil {
+		return nil, 0, err
+	}
+
+	// a broken tag is skipped without its content
+	t, _ := id3.Parse(buf)
+	return t, int64(size), nil
+}
+
+// skipID3v2 skips the ID3v2 tag at the current position of a seekable
+// source without reading it, as it can have large pictures.
+// The tag is read by loadID3v2 when it is needed.
+func (s *source) skipID3v2() error {
+	pos := s.pos
+	header := make([]byte, id3.HeaderSize)
+	if _, err := s.ReadFull(header); err != nil {
+		return err
+	}
+
+	size, err := id3.TagSize(header)
+	if err != nil {
+		// not a tag, which is left to the search of a frame
+		s.Unread(header)
+		return nil
+	}
+
+	if _, err := s.Seek(pos+int64(size), io.SeekStart); err != nil {
+		return err
+	}
+
+	s.id3v2Pos = pos
+	s.id3v2Size = size
+	return nil
+}
+
+// loadID3v2 returns the ID3v2 tag at the start,
+// which is read if it has been skipped by skipID3v2.
+func (s *source) loadID3v2() *id3.Tag {
+	if s.id3v2 != nil || s.id3v2Size == 0 {
+		return s.id3v2
+	}
+
+	// keep the position of the reader,
+	// which is ahead of the source if data has been unread
+	seeker := s.reader.(io.Seeker)
+	cur, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+
+	b, err := s.readAt(s.id3v2Pos, s.id3v2Size)
+	if _, serr := seeker.Seek(cur, io.SeekStart); serr != nil || err != nil {
+		return nil
+	}
+
+	// a broken tag is not read again
+	s.id3v2Size = 0
+	s.id3v2, _ = id3.Parse(b)
+	return s.id3v2
+}
+
+// SkipTag skips the ID3v2 tag between frames at the current position
+// and returns the number of bytes skipped, which is 0 when there is none.
+func (s *source) SkipTag() (int64, error) {
+	pos := s.pos
+	header := make([]byte, id3.HeaderSize)
+	n, err := s.ReadFull(header)
+	if err != nil {
+		s.Unread(header[:n])
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if string(header[:3]) == "3DI" {
+		// the footer of a tag whose start is before the position
+		copy(header, "ID3")
+		if _, err := id3.TagSize(header); err == nil {
+			return id3.HeaderSize, nil
+		}
+
+		copy(header, "3DI")
+		s.Unread(header)
+		return 0, nil
+	}
+
+	s.Unread(header)
+	t, n64, err := s.readID3v2()
+	if err != nil {
+		return 0, err
+	}
+
+	if t != nil && s.onID3v2 != nil {
+		s.onID3v2(t, pos)
+	}
+
+	return n64, nil
+}
+
+// readTrailingTags reads the tags at the end of the stream
+// and sets the end of the audio before them.
+// The source is left at the current position.
+func (s *source) readTrailingTags() error {
+	seeker, ok := s.reader.(io.Seeker)
+	if !ok {
+		return nil
+	}
+
+	cur, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if end, err = s.readID3v1(end); err != nil {
+		return err
+	}
+
+	// APE tags and Lyrics3 blocks come before the ID3v1 tag in any order
+	for {
+		start, err := s.readTrailer(end)
+		if err != nil {
+			return err
+		}
+
+		if start == end {
+			break
+		}
+		end = start
+	}
+	s.end = end
+
+	if _, err := seeker.Seek(cur, io.SeekStart); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readID3v1 reads the ID3v1 tag that ends at end if there is one,
+// and returns the position where it starts.
+func (s *source) readID3v1(end int64) (int64, error) {
+	if end < id3.V1Size {
+		return end, nil
+	}
+
+	b, err := s.readAt(end-id3.V1Size, id3.V1Size)
+	if err != nil {
+		return 0, err
+	}
+
+	if string(b[:3]) != "TAG" {
+		return end, nil
+	}
+
+	end -= id3.V1Size
+	if end >= id3.V1ExtendedSize {
+		ext, err := s.readAt(end-id3.V1ExtendedSize, id3.V1ExtendedSize)
+		if err != nil {
+			return 0, err
+		}
+
+		if string(ext[:4]) == "TAG+" {
+			end -= id3.V1ExtendedSize
+			b = append(ext, b...)
+		}
+	}
+
+	s.id3v1, _ = id3.ParseV1(b)
+	return end, nil
+}
+
+// readTrailer reads the APE tag or the Lyrics3 block that ends at end
+// if there is one, and returns the position where it starts,
+// which is end when there is none.
+func (s *source) readTrailer(end int64) (int64, error) {
+	if end < ape.HeaderSize {
+		return end, nil
+	}
+
+	b, err := s.readAt(end-ape.HeaderSize, ape.HeaderSize)
+	if err != nil {
+		return 0, err
+	}
+
+	if ape.IsFooter(b) {
+		size, err := ape.TagSize(b)
+		if err != nil || int64(size) > end {
+			return end, nil
+		}
+
+		b, err := s.readAt(end-int64(size), size)
+		if err != nil {
+			return 0, err
+		}
+
+		// a broken tag is excluded without its content
+		if t, err := ape.Parse(b); err == nil {
+			s.ape = t
+		}
+		return end - int64(size), nil
+	}
+
+	if footer := b[ape.HeaderSize-id3.HeaderSize:]; string(footer[:3]) == "3DI" {
+		// a tag appended with a footer, which is reported as it is not
+		// read while decoding
+		header := append([]byte("ID3"), footer[3:]...)
+		size, err := id3.TagSize(header)
+		if err != nil || int64(size) > end {
+			return end, nil
+		}
+
+		start := end - int64(size)
+		b, err := s.readAt(start, size)
+		if err != nil {
+			return 0, err
+		}
+
+		if string(b[:3]) != "ID3" {
+			return end, nil
+		}
+
+		if t, err := id3.Parse(b); err == nil && s.onID3v2 != nil {
+			s.onID3v2(t, start)
+		}
+		return start, nil
+	}
+
+	switch string(b[ape.HeaderSize-9:]) {
+	case "LYRICS200":
+		// Lyrics3v2 has the size of the block before the end marker
+		size, err := strconv.Atoi(string(b[ape.HeaderSize-15 : ape.HeaderSize-9]))
+		if err != nil {
+			return end, nil
+		}
+
+		start := end - 15 - int64(size)
+		if start < 0 {
+			return end, nil
+		}
+
+		begin, err := s.readAt(start, len(lyricsBegin))
+		if err != nil {
+			return 0, err
+		}
+
+		if string(begin) == lyricsBegin {
+			return start, nil
+		}
+	case "LYRICSEND":
+		// Lyrics3v1 has no size, but it is at most 5100 bytes
+		n := int64(len(lyricsBegin) + 5100 + 9)
+		if n > end {
+			n = end
+		}
+
+		b, err := s.readAt(end-n, int(n))
+		if err != nil {
+			return 0, err
+		}
+
+		if i := strings.LastIndex(string(b), lyricsBegin); i >= 0 {
+			return end - n + int64(i), nil
+		}
+	}
+
+	return end, nil
+}
+
+// readAt reads n bytes at the position pos of the seekable reader.
+func (s *source) readAt(pos int64, n int) ([]byte, error) {
+	if _, err := s.reader.(io.Seeker).Seek(pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(s.reader, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// frameSize returns the size of the frame with the header h
+// that has just been read from the source.
+func (s *source) frameSize(h frameheader.FrameHeader) (int, error) {
+	if !h.IsFreeFormat() {
+		return h.FrameSize()
+	}
+
+	if s.freeFormatSize == 0 {
+		size, err := frameheader.FreeFormatSize(s, h)
+		if err != nil {
+			return 0, err
+		}
+		s.freeFormatSize = size
+	}
+
+	return h.FreeFormatFrameSize(s.freeFormatSize), nil
+}
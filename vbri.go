@@ -0,0 +1,118 @@
+package mp3
+
+import (
+	"encoding/binary"
+
+	"github.com/pchchv/mp3/internal/consts"
+	"github.com/pchchv/mp3/internal/frameheader"
+)
+
+// vbriOffset is the offset of the VBRI header from the end of the frame header.
+const vbriOffset = 32
+
+// VBRIHeader is the VBRI header that Fraunhofer encoders write
+// in place of the audio data of the first frame.
+type VBRIHeader struct {
+	// Version is the version of the header.
+	Version int
+
+	// Delay is the encoder delay.
+	Delay int
+
+	// Quality is the VBR quality.
+	Quality int
+
+	// Bytes is the size of the stream in bytes, or 0 when it is not available.
+	Bytes int64
+
+	// Frames is the number of audio frames, not counting the one
+	// with the header, or 0 when it is not available.
+	Frames int64
+
+	// Scale is the factor the entries of the table of contents are scaled by.
+	Scale int
+
+	// EntrySize is the size in bytes of an entry of the table of contents.
+	EntrySize int
+
+	// FramesPerEntry is the number of frames an entry
+	// of the table of contents covers.
+	FramesPerEntry int
+
+	// TOC is the table of contents for seeking, or nil when it is not available.
+	// TOC[i] is the size in bytes, already multiplied by Scale,
+	// of the FramesPerEntry frames from the i*FramesPerEntry-th frame
+	// after the one with the header.
+	TOC []int64
+}
+
+// parseVBRI parses the VBRI header in the frame with the header h.
+// body is the frame without its 4 header bytes.
+// parseVBRI returns nil when the frame has no VBRI header.
+func parseVBRI(h frameheader.FrameHeader, body []byte) *VBRIHeader {
+	if h.Layer() != consts.Layer3 {
+		return nil
+	}
+
+	if len(body) < vbriOffset+26 {
+		return nil
+	}
+
+	b := body[vbriOffset:]
+	if string(b[:4]) != "VBRI" {
+		return nil
+	}
+
+	v := &VBRIHeader{
+		Version:        int(binary.BigEndian.Uint16(b[4:6])),
+		Delay:          int(binary.BigEndian.Uint16(b[6:8])),
+		Quality:        int(binary.BigEndian.Uint16(b[8:10])),
+		Bytes:          int64(binary.BigEndian.Uint32(b[10:14])),
+		Frames:         int64(binary.BigEndian.Uint32(b[14:18])),
+		Scale:          int(binary.BigEndian.Uint16(b[20:22])),
+		EntrySize:      int(binary.BigEndian.Uint16(b[22:24])),
+		FramesPerEntry: int(binary.BigEndian.Uint16(b[24:26])),
+	}
+
+	entries := int(binary.BigEndian.Uint16(b[18:20]))
+	if entries == 0 || v.FramesPerEntry == 0 || v.EntrySize < 1 || v.EntrySize > 4 {
+		return v
+	}
+
+	b = b[26:]
+	if len(b) < entries*v.EntrySize {
+		return nil
+	}
+
+	v.TOC = make([]int64, entries)
+	for i := range v.TOC {
+		var e int64
+		for _, c := range b[:v.EntrySize] {
+			e = e<<8 | int64(c)
+		}
+		v.TOC[i] = e * int64(v.Scale)
+		b = b[v.EntrySize:]
+	}
+
+	return v
+}
+
+// seekOffset returns the offset in bytes from the frame after the one
+// with the header to seek to for the given number of frames.
+func (v *VBRIHeader) seekOffset(frames float64) int64 {
+	if frames < 0 {
+		frames = 0
+	}
+
+	// interpolate linearly within the entry
+	var offset int64
+	for _, e := range v.TOC {
+		if frames < float64(v.FramesPerEntry) {
+			return offset + int64(frames/float64(v.FramesPerEntry)*float64(e))
+		}
+		offset += e
+		frames -= float64(v.FramesPerEntry)
+	}
+
+	return offset
+}
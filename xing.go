@@ -0,0 +1,134 @@
+package mp3
+
+import (
+	"encoding/binary"
+
+	"github.com/pchchv/mp3/internal/consts"
+	"github.com/pchchv/mp3/internal/frameheader"
+)
+
+const (
+	xingFramesFlag  = 0x1
+	xingBytesFlag   = 0x2
+	xingTOCFlag     = 0x4
+	xingQualityFlag = 0x8
+)
+
+// XingHeader is the Xing header that encoders like LAME write
+// in place of the audio data of the first frame.
+type XingHeader struct {
+	// Tag is "Xing" for VBR streams and "Info" for CBR streams.
+	Tag string
+
+	// Frames is the number of audio frames, not counting the one
+	// with the header, or 0 when it is not available.
+	Frames int64
+
+	// Bytes is the size of the stream in bytes from the frame with
+	// the header on, or 0 when it is not available.
+	Bytes int64
+
+	// TOC is the table of contents for seeking, or nil when it is not available.
+	// TOC[i] is the position of i percent of the duration,
+	// in 1/256 of the size of the stream.
+	TOC []byte
+
+	// Quality is the VBR quality from 0 (best) to 100 (worst),
+	// or -1 when it is not available.
+	Quality int
+
+	// LAME is the LAME extension of the header, or nil when there is none.
+	LAME *LAMEHeader
+}
+
+// parseXing parses the Xing header in the frame with the header h.
+// body is the frame without its 4 header bytes.
+// parseXing returns nil when the frame has no Xing header.
+func parseXing(h frameheader.FrameHeader, body []byte) *XingHeader {
+	if h.Layer() != consts.Layer3 {
+		return nil
+	}
+
+	// the header is right after the side info
+	offset := h.SideInfoSize()
+	if h.ProtectionBit() == 0 {
+		offset += 2
+	}
+
+	if len(body) < offset+8 {
+		return nil
+	}
+
+	b := body[offset:]
+	tag := string(b[:4])
+	if tag != "Xing" && tag != "Info" {
+		return nil
+	}
+
+	x := &XingHeader{
+		Tag:     tag,
+		Quality: -1,
+	}
+	flags := binary.BigEndian.Uint32(b[4:8])
+	b = b[8:]
+	if flags&xingFramesFlag != 0 {
+		if len(b) < 4 {
+			return nil
+		}
+		x.Frames = int64(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+
+	if flags&xingBytesFlag != 0 {
+		if len(b) < 4 {
+			return nil
+		}
+		x.Bytes = int64(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+
+	if flags&xingTOCFlag != 0 {
+		if len(b) < 100 {
+			return nil
+		}
+		x.TOC = append([]byte{}, b[:100]...)
+		b = b[100:]
+	}
+
+	if flags&xingQualityFlag != 0 {
+		if len(b) < 4 {
+			return nil
+		}
+		x.Quality = int(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+
+	x.LAME = parseLAME(b)
+	return x
+}
+
+// seekOffset returns the offset in bytes from the frame with the header
+// to seek to for the given fraction of the duration.
+// size is the size of the stream used when Bytes is not available.
+func (x *XingHeader) seekOffset(fraction float64, size int64) int64 {
+	if x.Bytes > 0 {
+		size = x.Bytes
+	}
+
+	percent := fraction * 100
+	if percent < 0 {
+		percent = 0
+	} else if percent > 99.999 {
+		percent = 99.999
+	}
+
+	// interpolate linearly between the entries
+	i := int(percent)
+	a := float64(x.TOC[i])
+	b := 256.0
+	if i < 99 {
+		b = float64(x.TOC[i+1])
+	}
+
+	return int64((a + (b-a)*(percent-float64(i))) / 256 * float64(size))
+}